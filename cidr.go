@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// IP range in CIDR notation, like `10.0.0.0/8`, inside of the allowed
+// supernets and not broader than the minimum prefix lengths. A single
+// address is accepted as the range made only by itself. When only one of
+// the minimum prefix lengths is set, the ranges of the other family are
+// rejected, otherwise `::/0` would bypass a bound meant for `0.0.0.0/0`.
+type cidrCheck struct {
+	within []netip.Prefix
+	// Minimum prefix lengths of the IPv4 and of the IPv6 ranges
+	minPrefix, minPrefixV6 *int
+}
+
+func newCIDRCheck(within []string, minPrefix, minPrefixV6 *int) (valueCheck, error) {
+	c := cidrCheck{minPrefix: minPrefix, minPrefixV6: minPrefixV6}
+	for _, raw := range within {
+		supernet, err := netip.ParsePrefix(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid supernet '%s'", raw)
+		}
+		c.within = append(c.within, supernet.Masked())
+	}
+	if minPrefix != nil && (*minPrefix < 0 || *minPrefix > 32) {
+		return nil, fmt.Errorf("min_prefix must be between 0 and 32")
+	}
+	if minPrefixV6 != nil && (*minPrefixV6 < 0 || *minPrefixV6 > 128) {
+		return nil, fmt.Errorf("min_prefix_v6 must be between 0 and 128")
+	}
+	for _, supernet := range c.within {
+		if supernet.Addr().Is6() && minPrefix != nil && minPrefixV6 == nil {
+			return nil, fmt.Errorf("min_prefix_v6 is required by the IPv6 supernet '%s'", supernet)
+		}
+		if supernet.Addr().Is4() && minPrefixV6 != nil && minPrefix == nil {
+			return nil, fmt.Errorf("min_prefix is required by the IPv4 supernet '%s'", supernet)
+		}
+	}
+	return c, nil
+}
+
+// Parses either a CIDR or a single address
+func parseCIDR(value string) (netip.Prefix, error) {
+	if !strings.Contains(value, "/") {
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+
+	prefix, err := netip.ParsePrefix(value)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	if prefix.Addr().Is4In6() {
+		// ::ffff:10.0.0.0/104 is the same range as 10.0.0.0/8
+		bits := prefix.Bits() - 96
+		if bits < 0 {
+			return netip.Prefix{}, fmt.Errorf("invalid IPv4-mapped prefix")
+		}
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), bits)
+	}
+	return prefix.Masked(), nil
+}
+
+func (c cidrCheck) check(value string) string {
+	prefix, err := parseCIDR(value)
+	if err != nil {
+		return "must be a CIDR like 10.0.0.0/8"
+	}
+
+	minPrefix, otherMinPrefix := c.minPrefix, c.minPrefixV6
+	if prefix.Addr().Is6() {
+		minPrefix, otherMinPrefix = c.minPrefixV6, c.minPrefix
+	}
+	if minPrefix == nil && otherMinPrefix != nil {
+		if prefix.Addr().Is6() {
+			return "must be an IPv4 range"
+		}
+		return "must be an IPv6 range"
+	}
+	if minPrefix != nil && prefix.Bits() < *minPrefix {
+		return fmt.Sprintf("must have a prefix length of at least %d", *minPrefix)
+	}
+
+	if len(c.within) == 0 {
+		return ""
+	}
+	for _, supernet := range c.within {
+		if supernet.Bits() <= prefix.Bits() && supernet.Contains(prefix.Addr()) {
+			return ""
+		}
+	}
+	return fmt.Sprintf("must be within %s", c.supernets())
+}
+
+func (c cidrCheck) supernets() string {
+	supernets := []string{}
+	for _, supernet := range c.within {
+		supernets = append(supernets, supernet.String())
+	}
+	return strings.Join(supernets, " ")
+}
+
+func (c cidrCheck) String() string {
+	if len(c.within) == 0 {
+		return "cidr"
+	}
+	return fmt.Sprintf("cidr within %s", c.supernets())
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCIDRConstraints(t *testing.T) {
+	private := `{"type": "cidr", "within": ["10.0.0.0/8", "fd00::/8"], "min_prefix": 16, "min_prefix_v6": 48}`
+
+	cases := []struct {
+		spec   string
+		value  string
+		reason string
+	}{
+		{`{"type": "cidr"}`, "0.0.0.0/0", ""},
+		{`{"type": "cidr"}`, "192.168.1.7", ""},
+		{`{"type": "cidr"}`, "10.0.0.0/33", "must be a CIDR like 10.0.0.0/8"},
+		{`{"type": "cidr"}`, "example.com", "must be a CIDR like 10.0.0.0/8"},
+		{`{"type": "cidr", "min_prefix": 8}`, "0.0.0.0/0", "must have a prefix length of at least 8"},
+		{`{"type": "cidr", "min_prefix": 8}`, "::/0", "must be an IPv4 range"},
+		{`{"type": "cidr", "min_prefix": 8}`, "2001:db8::/64", "must be an IPv4 range"},
+		{`{"type": "cidr", "min_prefix_v6": 48}`, "0.0.0.0/0", "must be an IPv6 range"},
+		{`{"type": "cidr", "min_prefix": 8, "min_prefix_v6": 48}`, "::/0", "must have a prefix length of at least 48"},
+		{private, "10.1.0.0/16", ""},
+		{private, "10.1.2.3", ""},
+		{private, "10.1.2.3/24", ""},
+		{private, "::ffff:10.1.0.0/112", ""},
+		{private, "10.0.0.0/8", "must have a prefix length of at least 16"},
+		{private, "0.0.0.0/0", "must have a prefix length of at least 16"},
+		{private, "192.168.0.0/16", "must be within 10.0.0.0/8 fd00::/8"},
+		{private, "fd12:3456::/48", ""},
+		{private, "fd12::/16", "must have a prefix length of at least 48"},
+		{private, "2001:db8::/48", "must be within 10.0.0.0/8 fd00::/8"},
+		{private, "::/0", "must have a prefix length of at least 48"},
+	}
+
+	for _, tc := range cases {
+		check := compileTypedConstraint(t, tc.spec)
+		if reason := check.check(tc.value); reason != tc.reason {
+			t.Errorf("%s with value '%s': expected reason '%s', got '%s'", tc.spec, tc.value, tc.reason, reason)
+		}
+	}
+}
+
+func TestInvalidCIDRConstraints(t *testing.T) {
+	cases := []string{
+		`{"type": "cidr", "within": ["10.0.0.0"]}`,
+		`{"type": "cidr", "within": ["10.0.0.0/40"]}`,
+		`{"type": "cidr", "min_prefix": 33}`,
+		`{"type": "cidr", "min_prefix_v6": -1}`,
+		`{"type": "cidr", "min": 8}`,
+		`{"type": "cidr", "within": ["10.0.0.0/8", "fd00::/8"], "min_prefix": 16}`,
+		`{"type": "cidr", "within": ["10.0.0.0/8", "fd00::/8"], "min_prefix_v6": 48}`,
+		`{"within": ["10.0.0.0/8"]}`,
+	}
+
+	for _, spec := range cases {
+		entry := constraintEntry{}
+		if err := json.Unmarshal([]byte(spec), &entry); err == nil {
+			t.Errorf("Expected %s to be rejected", spec)
+		}
+	}
+}
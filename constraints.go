@@ -0,0 +1,476 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A check on the value of an annotation, on top of the regular expression
+type valueCheck interface {
+	// Returns the reason why the value is not valid, an empty string
+	// when the value is valid
+	check(value string) string
+	// Describes the values accepted by the check
+	String() string
+}
+
+// A bound of a typed constraint. It can be written either as a JSON
+// string or as a JSON number, like `"5m"` or `10`.
+type boundValue string
+
+func (b *boundValue) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*b = boundValue(text)
+		return nil
+	}
+
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return fmt.Errorf("bound must be either a string or a number: %s", string(data))
+	}
+	*b = boundValue(number.String())
+	return nil
+}
+
+// The typed constraint of a constrained_annotations entry:
+//
+//	{ "type": "int", "min": 1, "max": 10 }
+type typedConstraintSpec struct {
+	Type    string      `json:"type"`
+	Min     *boundValue `json:"min"`
+	Max     *boundValue `json:"max"`
+	Values  []string    `json:"values"`
+	Range   string      `json:"range"`
+	Schemes []string    `json:"schemes"`
+	// Used by the json type
+	Schema     json.RawMessage `json:"schema"`
+	Assertions []jsonAssertion `json:"assertions"`
+	// Used by the cidr type
+	Within      []string `json:"within"`
+	MinPrefix   *int     `json:"min_prefix"`
+	MinPrefixV6 *int     `json:"min_prefix_v6"`
+}
+
+// Builds the check described by the spec, returns nil when the spec does
+// not define a type
+func (spec *typedConstraintSpec) compile() (valueCheck, error) {
+	if spec.Type == "" {
+		if used := spec.usedOptions(); len(used) > 0 {
+			return nil, fmt.Errorf("option %s requires a type", used[0])
+		}
+		return nil, nil
+	}
+
+	if err := spec.onlyAllows(allowedTypedConstraintOptions[spec.Type]...); err != nil {
+		return nil, err
+	}
+
+	switch spec.Type {
+	case "int":
+		return newIntCheck(spec.Min, spec.Max)
+	case "bool":
+		return boolCheck{}, nil
+	case "enum":
+		if len(spec.Values) == 0 {
+			return nil, fmt.Errorf("type enum requires a list of values")
+		}
+		return enumCheck{values: spec.Values}, nil
+	case "duration":
+		return newDurationCheck(spec.Min, spec.Max)
+	case "quantity":
+		return newQuantityCheck(spec.Min, spec.Max)
+	case "timestamp":
+		return newTimestampCheck(spec.Min, spec.Max)
+	case "semver":
+		return newSemverCheck(spec.Range)
+	case "url":
+		return newURLCheck(spec.Schemes), nil
+	case "json":
+		return newJSONCheck(spec.Schema, spec.Assertions)
+	case "cidr":
+		return newCIDRCheck(spec.Within, spec.MinPrefix, spec.MinPrefixV6)
+	case "yaml":
+		return nil, fmt.Errorf("type yaml is not supported, no YAML parser is available to the policy")
+	default:
+		return nil, fmt.Errorf("unknown constraint type '%s'", spec.Type)
+	}
+}
+
+// The options that can be used by each type
+var allowedTypedConstraintOptions = map[string][]string{
+	"int":       {"min", "max"},
+	"bool":      {},
+	"enum":      {"values"},
+	"duration":  {"min", "max"},
+	"quantity":  {"min", "max"},
+	"timestamp": {"min", "max"},
+	"semver":    {"range"},
+	"url":       {"schemes"},
+	"json":      {"schema", "assertions"},
+	"cidr":      {"within", "min_prefix", "min_prefix_v6"},
+}
+
+// Returns the options set by the spec
+func (spec *typedConstraintSpec) usedOptions() []string {
+	used := []string{}
+	for _, option := range []struct {
+		name string
+		set  bool
+	}{
+		{"min", spec.Min != nil},
+		{"max", spec.Max != nil},
+		{"values", spec.Values != nil},
+		{"range", spec.Range != ""},
+		{"schemes", spec.Schemes != nil},
+		{"schema", spec.Schema != nil},
+		{"assertions", spec.Assertions != nil},
+		{"within", spec.Within != nil},
+		{"min_prefix", spec.MinPrefix != nil},
+		{"min_prefix_v6", spec.MinPrefixV6 != nil},
+	} {
+		if option.set {
+			used = append(used, option.name)
+		}
+	}
+	return used
+}
+
+func (spec *typedConstraintSpec) onlyAllows(options ...string) error {
+	for _, used := range spec.usedOptions() {
+		allowed := false
+		for _, option := range options {
+			allowed = allowed || used == option
+		}
+		if !allowed {
+			return fmt.Errorf("option %s cannot be used with type %s", used, spec.Type)
+		}
+	}
+	return nil
+}
+
+// Integer, within optional bounds
+type intCheck struct {
+	min, max *int64
+}
+
+func newIntCheck(minBound, maxBound *boundValue) (valueCheck, error) {
+	c := intCheck{}
+	for _, bound := range []struct {
+		text   *boundValue
+		target **int64
+	}{{minBound, &c.min}, {maxBound, &c.max}} {
+		if bound.text == nil {
+			continue
+		}
+		value, err := strconv.ParseInt(string(*bound.text), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid int bound '%s'", *bound.text)
+		}
+		*bound.target = &value
+	}
+	if c.min != nil && c.max != nil && *c.min > *c.max {
+		return nil, fmt.Errorf("min cannot be greater than max")
+	}
+	return c, nil
+}
+
+func (c intCheck) check(value string) string {
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return "must be an integer"
+	}
+	if c.min != nil && number < *c.min {
+		return fmt.Sprintf("must be at least %d", *c.min)
+	}
+	if c.max != nil && number > *c.max {
+		return fmt.Sprintf("must be at most %d", *c.max)
+	}
+	return ""
+}
+
+func (c intCheck) String() string {
+	return describeBounds("int", c.min, c.max)
+}
+
+// Either `true` or `false`
+type boolCheck struct{}
+
+func (boolCheck) check(value string) string {
+	if value != "true" && value != "false" {
+		return "must be either true or false"
+	}
+	return ""
+}
+
+func (boolCheck) String() string {
+	return "bool"
+}
+
+// One of a list of values
+type enumCheck struct {
+	values []string
+}
+
+func (c enumCheck) check(value string) string {
+	for _, allowed := range c.values {
+		if value == allowed {
+			return ""
+		}
+	}
+	return fmt.Sprintf("must be one of %s", c.quotedValues())
+}
+
+func (c enumCheck) quotedValues() string {
+	quoted := []string{}
+	for _, value := range c.values {
+		quoted = append(quoted, fmt.Sprintf("'%s'", value))
+	}
+	return strings.Join(quoted, " ")
+}
+
+func (c enumCheck) String() string {
+	return fmt.Sprintf("enum %s", c.quotedValues())
+}
+
+// Go duration, like `1h30m`, within optional bounds
+type durationCheck struct {
+	min, max       *time.Duration
+	minRaw, maxRaw string
+}
+
+func newDurationCheck(minBound, maxBound *boundValue) (valueCheck, error) {
+	c := durationCheck{}
+	if minBound != nil {
+		value, err := time.ParseDuration(string(*minBound))
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration bound '%s'", *minBound)
+		}
+		c.min, c.minRaw = &value, string(*minBound)
+	}
+	if maxBound != nil {
+		value, err := time.ParseDuration(string(*maxBound))
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration bound '%s'", *maxBound)
+		}
+		c.max, c.maxRaw = &value, string(*maxBound)
+	}
+	if c.min != nil && c.max != nil && *c.min > *c.max {
+		return nil, fmt.Errorf("min cannot be greater than max")
+	}
+	return c, nil
+}
+
+func (c durationCheck) check(value string) string {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return "must be a duration like 1h30m"
+	}
+	if c.min != nil && duration < *c.min {
+		return fmt.Sprintf("must be at least %s", c.minRaw)
+	}
+	if c.max != nil && duration > *c.max {
+		return fmt.Sprintf("must be at most %s", c.maxRaw)
+	}
+	return ""
+}
+
+func (c durationCheck) String() string {
+	return describeRawBounds("duration", c.minRaw, c.maxRaw)
+}
+
+// Kubernetes resource quantity, like `500Mi`, within optional bounds
+type quantityCheck struct {
+	min, max       *big.Rat
+	minRaw, maxRaw string
+}
+
+func newQuantityCheck(minBound, maxBound *boundValue) (valueCheck, error) {
+	c := quantityCheck{}
+	if minBound != nil {
+		value, err := parseQuantity(string(*minBound))
+		if err != nil {
+			return nil, fmt.Errorf("invalid quantity bound '%s'", *minBound)
+		}
+		c.min, c.minRaw = value, string(*minBound)
+	}
+	if maxBound != nil {
+		value, err := parseQuantity(string(*maxBound))
+		if err != nil {
+			return nil, fmt.Errorf("invalid quantity bound '%s'", *maxBound)
+		}
+		c.max, c.maxRaw = value, string(*maxBound)
+	}
+	if c.min != nil && c.max != nil && c.min.Cmp(c.max) > 0 {
+		return nil, fmt.Errorf("min cannot be greater than max")
+	}
+	return c, nil
+}
+
+func (c quantityCheck) check(value string) string {
+	quantity, err := parseQuantity(value)
+	if err != nil {
+		return "must be a quantity like 500Mi"
+	}
+	if c.min != nil && quantity.Cmp(c.min) < 0 {
+		return fmt.Sprintf("must be at least %s", c.minRaw)
+	}
+	if c.max != nil && quantity.Cmp(c.max) > 0 {
+		return fmt.Sprintf("must be at most %s", c.maxRaw)
+	}
+	return ""
+}
+
+func (c quantityCheck) String() string {
+	return describeRawBounds("quantity", c.minRaw, c.maxRaw)
+}
+
+// RFC3339 timestamp, within optional bounds
+type timestampCheck struct {
+	min, max *time.Time
+}
+
+func newTimestampCheck(minBound, maxBound *boundValue) (valueCheck, error) {
+	c := timestampCheck{}
+	for _, bound := range []struct {
+		text   *boundValue
+		target **time.Time
+	}{{minBound, &c.min}, {maxBound, &c.max}} {
+		if bound.text == nil {
+			continue
+		}
+		value, err := time.Parse(time.RFC3339, string(*bound.text))
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp bound '%s'", *bound.text)
+		}
+		*bound.target = &value
+	}
+	if c.min != nil && c.max != nil && c.min.After(*c.max) {
+		return nil, fmt.Errorf("min cannot be greater than max")
+	}
+	return c, nil
+}
+
+func (c timestampCheck) check(value string) string {
+	timestamp, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return "must be an RFC3339 timestamp like 2006-01-02T15:04:05Z"
+	}
+	if c.min != nil && timestamp.Before(*c.min) {
+		return fmt.Sprintf("must not be before %s", c.min.Format(time.RFC3339))
+	}
+	if c.max != nil && timestamp.After(*c.max) {
+		return fmt.Sprintf("must not be after %s", c.max.Format(time.RFC3339))
+	}
+	return ""
+}
+
+func (c timestampCheck) String() string {
+	minRaw, maxRaw := "", ""
+	if c.min != nil {
+		minRaw = c.min.Format(time.RFC3339)
+	}
+	if c.max != nil {
+		maxRaw = c.max.Format(time.RFC3339)
+	}
+	return describeRawBounds("timestamp", minRaw, maxRaw)
+}
+
+// Semantic version, within an optional range
+type semverCheck struct {
+	versions *semverRange
+}
+
+func newSemverCheck(versions string) (valueCheck, error) {
+	if versions == "" {
+		return semverCheck{}, nil
+	}
+	parsed, err := parseSemverRange(versions)
+	if err != nil {
+		return nil, err
+	}
+	return semverCheck{versions: parsed}, nil
+}
+
+func (c semverCheck) check(value string) string {
+	version, err := parseSemanticVersion(value)
+	if err != nil {
+		return "must be a semantic version like 1.2.3"
+	}
+	if c.versions != nil && !c.versions.matches(version) {
+		return fmt.Sprintf("must satisfy the range '%s'", c.versions.raw)
+	}
+	return ""
+}
+
+func (c semverCheck) String() string {
+	if c.versions == nil {
+		return "semver"
+	}
+	return fmt.Sprintf("semver %s", c.versions.raw)
+}
+
+// Absolute URL, using one of the allowed schemes
+type urlCheck struct {
+	schemes []string
+}
+
+func newURLCheck(schemes []string) valueCheck {
+	c := urlCheck{}
+	for _, scheme := range schemes {
+		c.schemes = append(c.schemes, strings.ToLower(scheme))
+	}
+	return c
+}
+
+func (c urlCheck) check(value string) string {
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Scheme == "" || (parsed.Host == "" && parsed.Opaque == "") {
+		return "must be an absolute URL like https://example.com"
+	}
+	if len(c.schemes) == 0 {
+		return ""
+	}
+	for _, scheme := range c.schemes {
+		if strings.ToLower(parsed.Scheme) == scheme {
+			return ""
+		}
+	}
+	return fmt.Sprintf("must use one of the schemes %s", strings.Join(c.schemes, " "))
+}
+
+func (c urlCheck) String() string {
+	if len(c.schemes) == 0 {
+		return "url"
+	}
+	return fmt.Sprintf("url %s", strings.Join(c.schemes, " "))
+}
+
+func describeBounds(name string, minBound, maxBound *int64) string {
+	minRaw, maxRaw := "", ""
+	if minBound != nil {
+		minRaw = strconv.FormatInt(*minBound, 10)
+	}
+	if maxBound != nil {
+		maxRaw = strconv.FormatInt(*maxBound, 10)
+	}
+	return describeRawBounds(name, minRaw, maxRaw)
+}
+
+func describeRawBounds(name, minRaw, maxRaw string) string {
+	switch {
+	case minRaw != "" && maxRaw != "":
+		return fmt.Sprintf("%s between %s and %s", name, minRaw, maxRaw)
+	case minRaw != "":
+		return fmt.Sprintf("%s not lower than %s", name, minRaw)
+	case maxRaw != "":
+		return fmt.Sprintf("%s not greater than %s", name, maxRaw)
+	default:
+		return name
+	}
+}
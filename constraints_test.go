@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func compileTypedConstraint(t *testing.T, spec string) valueCheck {
+	t.Helper()
+
+	entry := constraintEntry{}
+	if err := json.Unmarshal([]byte(spec), &entry); err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	return entry.check
+}
+
+func TestTypedConstraints(t *testing.T) {
+	cases := []struct {
+		spec   string
+		value  string
+		reason string
+	}{
+		{`{"type": "int", "min": 1, "max": 10}`, "5", ""},
+		{`{"type": "int", "min": 1, "max": 10}`, "0", "must be at least 1"},
+		{`{"type": "int", "min": 1, "max": 10}`, "11", "must be at most 10"},
+		{`{"type": "int"}`, "1.5", "must be an integer"},
+		{`{"type": "bool"}`, "true", ""},
+		{`{"type": "bool"}`, "yes", "must be either true or false"},
+		{`{"type": "enum", "values": ["low", "high"]}`, "high", ""},
+		{`{"type": "enum", "values": ["low", "high"]}`, "medium", "must be one of 'low' 'high'"},
+		{`{"type": "duration", "min": "1m", "max": "1h"}`, "30m", ""},
+		{`{"type": "duration", "min": "1m", "max": "1h"}`, "30s", "must be at least 1m"},
+		{`{"type": "duration", "min": "1m", "max": "1h"}`, "1h1s", "must be at most 1h"},
+		{`{"type": "duration"}`, "tomorrow", "must be a duration like 1h30m"},
+		{`{"type": "quantity", "max": "1Gi"}`, "512Mi", ""},
+		{`{"type": "quantity", "max": "1Gi"}`, "1.5Gi", "must be at most 1Gi"},
+		{`{"type": "quantity", "min": "100m"}`, "0.1", ""},
+		{`{"type": "quantity", "min": 1}`, "2e3", ""},
+		{`{"type": "quantity"}`, "10Xi", "must be a quantity like 500Mi"},
+		{`{"type": "timestamp", "min": "2024-01-01T00:00:00Z"}`, "2024-06-01T10:00:00+02:00", ""},
+		{`{"type": "timestamp", "min": "2024-01-01T00:00:00Z"}`, "2023-12-31T23:59:59Z", "must not be before 2024-01-01T00:00:00Z"},
+		{`{"type": "timestamp"}`, "2024-01-01", "must be an RFC3339 timestamp like 2006-01-02T15:04:05Z"},
+		{`{"type": "semver", "range": ">=1.2.0 <2.0.0 || >=3.0.0"}`, "v1.4.0", ""},
+		{`{"type": "semver", "range": ">=1.2.0 <2.0.0 || >=3.0.0"}`, "3.0.0-rc.1", "must satisfy the range '>=1.2.0 <2.0.0 || >=3.0.0'"},
+		{`{"type": "semver", "range": ">=1.2.0 <2.0.0 || >=3.0.0"}`, "2.1.0", "must satisfy the range '>=1.2.0 <2.0.0 || >=3.0.0'"},
+		{`{"type": "semver"}`, "1.2", "must be a semantic version like 1.2.3"},
+		{`{"type": "url", "schemes": ["https"]}`, "https://example.com/docs", ""},
+		{`{"type": "url", "schemes": ["https"]}`, "http://example.com/docs", "must use one of the schemes https"},
+		{`{"type": "url"}`, "/docs", "must be an absolute URL like https://example.com"},
+	}
+
+	for _, tc := range cases {
+		check := compileTypedConstraint(t, tc.spec)
+		if reason := check.check(tc.value); reason != tc.reason {
+			t.Errorf("%s with value '%s': expected reason '%s', got '%s'", tc.spec, tc.value, tc.reason, reason)
+		}
+	}
+}
+
+func TestInvalidTypedConstraints(t *testing.T) {
+	cases := []string{
+		`{"type": "float"}`,
+		`{"type": "int", "min": "one"}`,
+		`{"type": "int", "schemes": ["https"]}`,
+		`{"type": "enum"}`,
+		`{"type": "duration", "max": "1 hour"}`,
+		`{"type": "quantity", "min": "1Xi"}`,
+		`{"type": "timestamp", "max": "2024-01-01"}`,
+		`{"type": "semver", "range": ">=1.2"}`,
+		`{"min": 1}`,
+		`{"message": "no regex nor type"}`,
+	}
+
+	for _, spec := range cases {
+		entry := constraintEntry{}
+		if err := json.Unmarshal([]byte(spec), &entry); err == nil {
+			t.Errorf("Expected %s to be rejected", spec)
+		}
+	}
+}
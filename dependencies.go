@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A dependencies entry: when an annotation is present, and optionally has
+// a given value, other annotations become mandatory or constrained:
+//
+//	{
+//	   "key": "prometheus.io/scrape",
+//	   "value": "true",
+//	   "requires": [ "prometheus.io/port" ],
+//	   "constrained_annotations": {
+//	      "prometheus.io/port": { "type": "int", "min": 1, "max": 65535 }
+//	   }
+//	}
+type Dependency struct {
+	// The annotation triggering the dependency
+	Key *KeyPattern `json:"key"`
+	// When set, the dependency is triggered only by the annotations
+	// having this value, or matching this regular expression
+	Value *string            `json:"value,omitempty"`
+	Regex *RegularExpression `json:"regex,omitempty"`
+	// The annotations that must be present
+	Requires []string `json:"requires,omitempty"`
+
+	constrainedPatterns []constrainedPattern
+	message             *ruleMessage
+}
+
+func (d *Dependency) UnmarshalJSON(data []byte) error {
+	rawDependency := struct {
+		Key                    *KeyPattern                `json:"key"`
+		Value                  *string                    `json:"value"`
+		Regex                  *RegularExpression         `json:"regex"`
+		Requires               []string                   `json:"requires"`
+		ConstrainedAnnotations map[string]constraintEntry `json:"constrained_annotations"`
+		ruleMessage
+	}{}
+
+	if err := json.Unmarshal(data, &rawDependency); err != nil {
+		return err
+	}
+	if rawDependency.Key == nil {
+		return fmt.Errorf("dependency without key: %s", string(data))
+	}
+	if rawDependency.Value != nil && rawDependency.Regex != nil {
+		return fmt.Errorf("dependency with both value and regex: %s", string(data))
+	}
+	if len(rawDependency.Requires) == 0 && len(rawDependency.ConstrainedAnnotations) == 0 {
+		return fmt.Errorf("dependency without requires or constrained_annotations: %s", string(data))
+	}
+
+	constrainedKeys := make([]string, 0, len(rawDependency.ConstrainedAnnotations))
+	for key := range rawDependency.ConstrainedAnnotations {
+		constrainedKeys = append(constrainedKeys, key)
+	}
+	sort.Strings(constrainedKeys)
+
+	d.constrainedPatterns = make([]constrainedPattern, 0, len(constrainedKeys))
+	for _, key := range constrainedKeys {
+		pattern, err := CompileKeyPattern(key)
+		if err != nil {
+			return err
+		}
+		entry := rawDependency.ConstrainedAnnotations[key]
+		if entry.mode != "" {
+			return fmt.Errorf("the constraints of a dependency follow the mode of its rule set, mode cannot be set on '%s'", key)
+		}
+		d.constrainedPatterns = append(d.constrainedPatterns, constrainedPattern{
+			key:       pattern,
+			value:     entry.Regex,
+			check:     entry.check,
+			reference: entry.reference,
+			list:      entry.list,
+			message:   entry.ruleMessage,
+		})
+	}
+
+	d.Key = rawDependency.Key
+	d.Value = rawDependency.Value
+	d.Regex = rawDependency.Regex
+	d.Requires = rawDependency.Requires
+	d.message = &rawDependency.ruleMessage
+	return nil
+}
+
+// Reports whether the annotation triggers the dependency
+func (d *Dependency) triggeredBy(annotation, value string) bool {
+	if !d.Key.Match(annotation) {
+		return false
+	}
+	switch {
+	case d.Value != nil:
+		return value == *d.Value
+	case d.Regex != nil:
+		return d.Regex.MatchString(value)
+	default:
+		return true
+	}
+}
+
+// Describes the condition triggering the dependency, like
+// `prometheus.io/scrape=true`
+func (d *Dependency) condition() string {
+	switch {
+	case d.Value != nil:
+		return fmt.Sprintf("%s=%s", d.Key, *d.Value)
+	case d.Regex != nil:
+		return fmt.Sprintf("%s=~%s", d.Key, d.Regex)
+	default:
+		return d.Key.String()
+	}
+}
+
+// Returns the dependencies whose requirements lead back to themselves.
+// Each cycle is described once, like `a -> b -> a`.
+func (r *RuleSet) dependencyCycles() []string {
+	// Dependency i leads to dependency j when one of the annotations
+	// required by i triggers j. A dependency never leads to itself: the
+	// annotations it requires are checked at once, and `a* requires ab`
+	// is satisfied as soon as ab is set.
+	edges := make([][]int, len(r.Dependencies))
+	for i, dependency := range r.Dependencies {
+		for j, other := range r.Dependencies {
+			if i == j {
+				continue
+			}
+			for _, required := range dependency.Requires {
+				if other.Key.Match(required) {
+					edges[i] = append(edges[i], j)
+					break
+				}
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(r.Dependencies))
+	path := []int{}
+	cycles := []string{}
+
+	var visit func(i int)
+	visit = func(i int) {
+		state[i] = visiting
+		path = append(path, i)
+		for _, j := range edges[i] {
+			switch state[j] {
+			case unvisited:
+				visit(j)
+			case visiting:
+				cycles = append(cycles, r.describeDependencyCycle(path, j))
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = visited
+	}
+
+	for i := range r.Dependencies {
+		if state[i] == unvisited {
+			visit(i)
+		}
+	}
+
+	sort.Strings(cycles)
+	return cycles
+}
+
+// Describes the cycle made by the end of the path that starts at the
+// given dependency
+func (r *RuleSet) describeDependencyCycle(path []int, start int) string {
+	keys := []string{}
+	for k := len(path) - 1; k >= 0; k-- {
+		keys = append([]string{r.Dependencies[path[k]].Key.String()}, keys...)
+		if path[k] == start {
+			break
+		}
+	}
+	keys = append(keys, r.Dependencies[start].Key.String())
+	return strings.Join(keys, " -> ")
+}
+
+// Returns the violations of the dependencies triggered by the annotations
+func (r *RuleSet) dependencyViolations(object objectInfo, metadataPath, field string, annotations map[string]string) []Violation {
+	violations := []Violation{}
+
+	keys := make([]string, 0, len(annotations))
+	for key := range annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for i := range r.Dependencies {
+		dependency := &r.Dependencies[i]
+		for _, trigger := range keys {
+			if !dependency.triggeredBy(trigger, annotations[trigger]) {
+				continue
+			}
+
+			for _, required := range dependency.Requires {
+				if _, found := annotations[required]; found {
+					continue
+				}
+				violation := newViolation(CategoryDependency, metadataPath, field, required, dependency.Key)
+				violation.Reason = "missing"
+				violation.condition = dependency.condition()
+				violation.Message = dependency.message.render(violation.messageData(object, "", ""))
+				violations = append(violations, violation)
+			}
+
+			for _, annotation := range keys {
+				for _, constraint := range dependency.constrainedPatterns {
+					if !constraint.key.Match(annotation) {
+						continue
+					}
+					failed, reason := constraint.failure(annotations[annotation], object.raw)
+					if !failed {
+						continue
+					}
+					if reason == "" {
+						reason = fmt.Sprintf("must match '%s'", constraint.value)
+					}
+					violation := newViolation(CategoryDependency, metadataPath, field, annotation, dependency.Key)
+					violation.Reason = reason
+					violation.condition = dependency.condition()
+					message := constraint.message
+					if message == nil || message.Message == nil {
+						message = dependency.message
+					}
+					violation.Message = message.render(
+						violation.messageData(object, annotations[annotation], constraint.expected()))
+					violations = append(violations, violation)
+				}
+			}
+
+			// The dependency is reported once, even when more
+			// annotations trigger it
+			break
+		}
+	}
+
+	return violations
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDependencyCycles(t *testing.T) {
+	ruleSet := RuleSet{}
+	if err := json.Unmarshal([]byte(`{
+		"dependencies": [
+			{ "key": "a", "requires": [ "b" ] },
+			{ "key": "b", "value": "on", "requires": [ "c" ] },
+			{ "key": "c*", "requires": [ "a" ] },
+			{ "key": "d", "requires": [ "a" ] },
+			{ "key": "e", "requires": [ "e", "f" ] },
+			{ "key": "g*", "requires": [ "gh" ] },
+			{ "key": "i", "requires": [ "i" ] }
+		]
+	}`), &ruleSet); err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	expected := []string{"a -> b -> c* -> a"}
+	if cycles := ruleSet.dependencyCycles(); !reflect.DeepEqual(cycles, expected) {
+		t.Errorf("Unexpected cycles: %v", cycles)
+	}
+}
+
+func TestInvalidDependencies(t *testing.T) {
+	cases := []string{
+		`{ "requires": [ "b" ] }`,
+		`{ "key": "a" }`,
+		`{ "key": "a", "value": "on", "regex": "^on$", "requires": [ "b" ] }`,
+		`{ "key": "a", "constrained_annotations": { "b": { "type": "unknown" } } }`,
+	}
+
+	for _, dependency := range cases {
+		if err := json.Unmarshal([]byte(dependency), &Dependency{}); err == nil {
+			t.Errorf("Expected %s to be rejected", dependency)
+		}
+	}
+}
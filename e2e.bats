@@ -113,3 +113,30 @@
   [ "$status" -eq 1 ]
   [ $(expr "$output" : ".*Provided settings are not valid: error parsing regexp: missing closing.*") -ne 0 ]
 }
+
+@test "mutate because denied annotation is stripped" {
+  run kwctl run annotated-policy.wasm \
+    -r test_data/ingress.json \
+    --settings-json '{"action": "strip", "denied_annotations": ["owner"]}'
+
+  # this prints the output when one the checks below fails
+  echo "output = ${output}"
+
+  # request accepted and mutated
+  [ "$status" -eq 0 ]
+  [ $(expr "$output" : '.*allowed.*true') -ne 0 ]
+  [ $(expr "$output" : '.*patchType.*JSONPatch') -ne 0 ]
+}
+
+@test "accept because the denied annotation is only monitored" {
+  run kwctl run annotated-policy.wasm \
+    -r test_data/ingress.json \
+    --settings-json '{"mode": "monitor", "denied_annotations": ["owner"]}'
+
+  # this prints the output when one the checks below fails
+  echo "output = ${output}"
+
+  # request accepted
+  [ "$status" -eq 0 ]
+  [ $(expr "$output" : '.*allowed.*true') -ne 0 ]
+}
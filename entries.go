@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/kubewarden/gjson"
+)
+
+// A denied_annotations entry, with its own action or the one of the
+// RuleSet defining it
+type deniedEntry struct {
+	*KeyPattern
+	action  Action
+	message *ruleMessage
+	// Empty when the entry follows the mode of the RuleSet
+	mode Mode
+}
+
+// A denied_annotations entry as provided by the user. It can be either
+// the annotation pattern, or an object with a custom message, action and
+// mode:
+//
+//	{ "key": "nginx.ingress.kubernetes.io/*-snippet", "message": "..." }
+//	{ "key": "example.com/legacy", "action": "strip", "mode": "monitor" }
+type deniedRawEntry struct {
+	Key    string `json:"key"`
+	Action Action `json:"action"`
+	Mode   Mode   `json:"mode"`
+	*ruleMessage
+}
+
+func (d *deniedRawEntry) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &d.Key); err == nil {
+		return nil
+	}
+
+	rawEntry := struct {
+		Key    string `json:"key"`
+		Action Action `json:"action"`
+		Mode   Mode   `json:"mode"`
+		ruleMessage
+	}{}
+
+	if err := json.Unmarshal(data, &rawEntry); err != nil {
+		return err
+	}
+	if rawEntry.Key == "" {
+		return fmt.Errorf("denied annotation without key: %s", string(data))
+	}
+
+	d.Key = rawEntry.Key
+	d.Action = rawEntry.Action
+	d.Mode = rawEntry.Mode
+	d.ruleMessage = &rawEntry.ruleMessage
+	return nil
+}
+
+// A mandatory_annotations entry. It can be either the annotation key, or
+// an object providing the value to add when the annotation is missing,
+// a custom message and a mode:
+//
+//	{ "key": "cost-center", "default": "cc-0000" }
+//	{ "key": "owner", "mode": "monitor" }
+type mandatoryEntry struct {
+	Key     string  `json:"key"`
+	Default *string `json:"default"`
+	Mode    Mode    `json:"mode"`
+	*ruleMessage
+}
+
+func (m *mandatoryEntry) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &m.Key); err == nil {
+		return nil
+	}
+
+	rawEntry := struct {
+		Key     string  `json:"key"`
+		Default *string `json:"default"`
+		Mode    Mode    `json:"mode"`
+		ruleMessage
+	}{}
+
+	if err := json.Unmarshal(data, &rawEntry); err != nil {
+		return err
+	}
+	if rawEntry.Key == "" {
+		return fmt.Errorf("mandatory annotation without key: %s", string(data))
+	}
+
+	m.Key = rawEntry.Key
+	m.Default = rawEntry.Default
+	m.Mode = rawEntry.Mode
+	m.ruleMessage = &rawEntry.ruleMessage
+	return nil
+}
+
+// A constrained_annotations value. It can be either the regular
+// expression, or an object with a regular expression, a typed
+// constraint, a reference to another field of the object, list options,
+// a custom message and a mode:
+//
+//	{ "regex": "^cc-\\d+$", "message": "..." }
+//	{ "type": "int", "min": 1, "max": 10 }
+//	{ "equals": "metadata.labels.team" }
+//	{ "separator": ",", "regex": "^[a-z]+$", "unique": true }
+//	{ "regex": "^[a-z]+$", "mode": "monitor" }
+type constraintEntry struct {
+	Regex     *RegularExpression `json:"regex"`
+	check     valueCheck
+	reference *fieldReference
+	list      *listSpec
+	mode      Mode
+	*ruleMessage
+}
+
+func (c *constraintEntry) UnmarshalJSON(data []byte) error {
+	var expr string
+	if err := json.Unmarshal(data, &expr); err == nil {
+		regex, err := CompileRegularExpression(expr)
+		if err != nil {
+			return err
+		}
+		c.Regex = regex
+		return nil
+	}
+
+	rawEntry := struct {
+		Regex  *RegularExpression `json:"regex"`
+		Equals string             `json:"equals"`
+		Format string             `json:"format"`
+		Mode   Mode               `json:"mode"`
+		typedConstraintSpec
+		listSpec
+		ruleMessage
+	}{}
+
+	if err := json.Unmarshal(data, &rawEntry); err != nil {
+		return err
+	}
+
+	check, err := rawEntry.typedConstraintSpec.compile()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, string(data))
+	}
+	reference, err := newFieldReference(rawEntry.Equals, rawEntry.Format)
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, string(data))
+	}
+	list, err := rawEntry.listSpec.compile()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, string(data))
+	}
+	if list != nil && reference != nil {
+		return fmt.Errorf("separator cannot be used with equals or format: %s", string(data))
+	}
+	if rawEntry.Regex == nil && check == nil && reference == nil && list == nil {
+		return fmt.Errorf("constrained annotation without regex, type, equals, format or separator: %s", string(data))
+	}
+
+	c.Regex = rawEntry.Regex
+	c.check = check
+	c.reference = reference
+	c.list = list
+	c.mode = rawEntry.Mode
+	c.ruleMessage = &rawEntry.ruleMessage
+	return nil
+}
+
+// A constrained_annotations entry, with its key compiled into a pattern
+type constrainedPattern struct {
+	key *KeyPattern
+	// Any of them can be nil
+	value     *RegularExpression
+	check     valueCheck
+	reference *fieldReference
+	// When set, the regular expression and the typed constraint apply to
+	// each element of the list
+	list    *listSpec
+	message *ruleMessage
+	// Empty when the constraint follows the mode of the RuleSet
+	mode Mode
+}
+
+// Tells whether the value does not satisfy the constraint, and why.
+// Values not matching the regular expression have no reason, unless they
+// are lists. The object is needed by the references to other fields, they
+// are not checked when it does not exist.
+func (c *constrainedPattern) failure(value string, object gjson.Result) (failed bool, reason string) {
+	if c.list != nil {
+		reason := c.list.check(value, c.value, c.check)
+		return reason != "", reason
+	}
+	if c.value != nil && !c.value.MatchString(value) {
+		return true, ""
+	}
+	if c.check != nil {
+		if reason := c.check.check(value); reason != "" {
+			return true, reason
+		}
+	}
+	if c.reference != nil {
+		if reason := c.reference.check(value, object); reason != "" {
+			return true, reason
+		}
+	}
+	return false, ""
+}
+
+// Reports whether the value cannot even be parsed by the typed
+// constraint, like a json value that is not valid JSON
+func (c *constrainedPattern) malformed(value string) bool {
+	parser, ok := c.check.(parsingCheck)
+	if !ok {
+		return false
+	}
+	if c.list != nil {
+		// Lists report their first invalid element
+		element, _, found := invalidElement(c.list.split(value), c.value, c.check)
+		return found && parser.parse(element) != nil
+	}
+	return parser.parse(value) != nil
+}
+
+// Describes the values accepted by the constraint
+func (c *constrainedPattern) expected() string {
+	switch {
+	case c.list != nil && c.value != nil:
+		return fmt.Sprintf("%s of %s", c.list, c.value)
+	case c.list != nil && c.check != nil:
+		return fmt.Sprintf("%s of %s", c.list, c.check)
+	case c.list != nil:
+		return c.list.String()
+	case c.value != nil:
+		return c.value.String()
+	case c.check != nil:
+		return c.check.String()
+	default:
+		return c.reference.String()
+	}
+}
+
+// A constraint that is not satisfied by the value of an annotation
+type failedConstraint struct {
+	constrainedPattern
+	reason string
+	// The value cannot be parsed, the reason is the parse error
+	malformed bool
+}
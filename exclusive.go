@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// An exclusive_annotations entry: a group of annotations where at most
+// one, or exactly one, can be present:
+//
+//	{
+//	   "keys": [ "cert-manager.io/cluster-issuer", "cert-manager.io/issuer" ],
+//	   "exactly_one": true
+//	}
+type ExclusiveGroup struct {
+	Keys []*KeyPattern `json:"keys"`
+	// Require one of the annotations to be present
+	ExactlyOne bool `json:"exactly_one,omitempty"`
+
+	message *ruleMessage
+}
+
+func (g *ExclusiveGroup) UnmarshalJSON(data []byte) error {
+	rawGroup := struct {
+		Keys       []*KeyPattern `json:"keys"`
+		ExactlyOne bool          `json:"exactly_one"`
+		ruleMessage
+	}{}
+
+	if err := json.Unmarshal(data, &rawGroup); err != nil {
+		return err
+	}
+	if len(rawGroup.Keys) < 2 {
+		return fmt.Errorf("exclusive annotations group with less than two keys: %s", string(data))
+	}
+
+	g.Keys = rawGroup.Keys
+	g.ExactlyOne = rawGroup.ExactlyOne
+	g.message = &rawGroup.ruleMessage
+	return nil
+}
+
+// Describes the group, like `cert-manager.io/cluster-issuer|cert-manager.io/issuer`
+func (g *ExclusiveGroup) String() string {
+	keys := []string{}
+	for _, key := range g.Keys {
+		keys = append(keys, key.String())
+	}
+	return strings.Join(keys, "|")
+}
+
+// Returns the annotations of the group that are present, sorted
+func (g *ExclusiveGroup) present(annotations map[string]string) []string {
+	present := []string{}
+	for annotation := range annotations {
+		if matchingKeyPattern(g.Keys, annotation) != nil {
+			present = append(present, annotation)
+		}
+	}
+	sort.Strings(present)
+	return present
+}
+
+// Returns the reason why the group cannot be satisfied by any object, an
+// empty string when it can. Denied and mandatory annotations are known
+// only when the keys of the group are not patterns.
+func (r *RuleSet) impossibleExclusiveGroup(group *ExclusiveGroup) string {
+	mandatory := []string{}
+	allDenied := true
+	for _, key := range group.Keys {
+		annotation, literal := key.Literal()
+		if !literal {
+			allDenied = false
+			continue
+		}
+		if r.MandatoryAnnotations.Contains(annotation) {
+			mandatory = append(mandatory, annotation)
+		}
+		if r.deniedPattern(annotation) == nil {
+			allDenied = false
+		}
+	}
+
+	switch {
+	case len(mandatory) > 1:
+		return fmt.Sprintf("more of them are mandatory: %s", strings.Join(mandatory, " "))
+	case group.ExactlyOne && allDenied:
+		return "all of them are denied"
+	case group.ExactlyOne && len(mandatory) == 1 && r.deniedPattern(mandatory[0]) != nil:
+		return fmt.Sprintf("%s is both mandatory and denied", mandatory[0])
+	}
+	return ""
+}
+
+// Returns the exclusive groups that cannot be satisfied by any object
+func (r *RuleSet) impossibleExclusiveGroups() []string {
+	impossible := []string{}
+	for i := range r.ExclusiveAnnotations {
+		group := &r.ExclusiveAnnotations[i]
+		if reason := r.impossibleExclusiveGroup(group); reason != "" {
+			impossible = append(impossible, fmt.Sprintf("%s (%s)", group, reason))
+		}
+	}
+	return impossible
+}
+
+// Returns the violations of the exclusive groups
+func (r *RuleSet) exclusiveViolations(object objectInfo, metadataPath, field string, annotations map[string]string) []Violation {
+	violations := []Violation{}
+
+	for i := range r.ExclusiveAnnotations {
+		group := &r.ExclusiveAnnotations[i]
+		present := group.present(annotations)
+
+		var reason string
+		switch {
+		case len(present) > 1 && group.ExactlyOne:
+			reason = "exactly one must be set"
+		case len(present) > 1:
+			reason = "at most one can be set"
+		case len(present) == 0 && group.ExactlyOne:
+			reason = "exactly one must be set"
+		default:
+			continue
+		}
+
+		found := []string{}
+		for _, annotation := range present {
+			found = append(found, fmt.Sprintf("'%s'", annotation))
+		}
+		if len(found) == 0 {
+			found = append(found, "none")
+		}
+
+		violation := newViolation(CategoryExclusive, metadataPath, field, "", literalKeyPattern(group.String()))
+		violation.Reason = fmt.Sprintf("%s, found %s", reason, strings.Join(found, " "))
+		violation.Message = group.message.render(violation.messageData(object, "", ""))
+		violations = append(violations, violation)
+	}
+
+	return violations
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	mapset "github.com/deckarep/golang-set/v2"
+	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
+)
+
+// Prefix of the usernames of the service accounts, followed by
+// `<namespace>:<name>`
+const serviceAccountUsernamePrefix = "system:serviceaccount:"
+
+// Skips some categories of rules for the requests made by the matching
+// users. Controllers, like cert-manager and Argo CD, legitimately set
+// annotations that are denied to humans:
+//
+//	{
+//	   "service_accounts": [ "cert-manager/*" ],
+//	   "categories": [ "denied", "reserved" ]
+//	}
+type Exemption struct {
+	// Patterns matching request.userInfo.username
+	Usernames []*KeyPattern `json:"usernames"`
+	// Patterns matching any of request.userInfo.groups
+	Groups []*KeyPattern `json:"groups"`
+	// Patterns matching the service accounts, as `<namespace>/<name>`
+	ServiceAccounts []*KeyPattern `json:"service_accounts"`
+	// The categories of rules that are skipped, all of them when empty
+	Categories []Category `json:"categories"`
+}
+
+// Reports whether the exemption applies to the requesting user
+func (e *Exemption) matches(user kubewarden_protocol.UserInfo) bool {
+	if matchingKeyPattern(e.Usernames, user.Username) != nil {
+		return true
+	}
+
+	for _, group := range user.Groups {
+		if matchingKeyPattern(e.Groups, group) != nil {
+			return true
+		}
+	}
+
+	if serviceAccount, found := strings.CutPrefix(user.Username, serviceAccountUsernamePrefix); found {
+		namespace, name, _ := strings.Cut(serviceAccount, ":")
+		if matchingKeyPattern(e.ServiceAccounts, namespace+"/"+name) != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the categories skipped for the requesting user, together with
+// the indexes of the exemptions that matched
+func (s *Settings) exemptCategories(user kubewarden_protocol.UserInfo) (mapset.Set[Category], []int) {
+	categories := mapset.NewThreadUnsafeSet[Category]()
+	matched := []int{}
+	for i, exemption := range s.Exemptions {
+		if !exemption.matches(user) {
+			continue
+		}
+		matched = append(matched, i)
+		if len(exemption.Categories) == 0 {
+			categories.Append(categoriesOrder...)
+		} else {
+			categories.Append(exemption.Categories...)
+		}
+	}
+	return categories, matched
+}
+
+// Returns the errors of the exemptions that cannot match any user
+func (s *Settings) exemptionErrors() []string {
+	errors := []string{}
+	for i, exemption := range s.Exemptions {
+		if len(exemption.Usernames) == 0 && len(exemption.Groups) == 0 && len(exemption.ServiceAccounts) == 0 {
+			errors = append(errors, fmt.Sprintf("exemptions[%d]: at least one of usernames, groups or service_accounts is required", i))
+		}
+	}
+	return errors
+}
+
+// The violations and the changes skipped because of the exemptions
+type exemptedFindings struct {
+	Violations []Violation `json:"violations,omitempty"`
+	Mutations  []string    `json:"mutations,omitempty"`
+}
+
+func (f *exemptedFindings) isEmpty() bool {
+	return len(f.Violations) == 0 && len(f.Mutations) == 0
+}
+
+// Removes the violations of the exempt categories from the report, and
+// the changes made by their rules from the patches. Stripping denied
+// annotations is skipped together with the denied category, adding
+// default values together with the mandatory one.
+// Returns the patches that are still needed, and what has been skipped.
+func applyExemptions(report *Report, patches []metadataPatch, categories mapset.Set[Category]) ([]metadataPatch, exemptedFindings) {
+	skipped := exemptedFindings{}
+
+	report.sort()
+	violations := []Violation{}
+	for _, violation := range report.Violations {
+		if categories.Contains(violation.Category) {
+			skipped.Violations = append(skipped.Violations, violation)
+		} else {
+			violations = append(violations, violation)
+		}
+	}
+	report.Violations = violations
+
+	kept := []metadataPatch{}
+	for _, patch := range patches {
+		if categories.Contains(CategoryDenied) {
+			for _, key := range patch.remove {
+				skipped.Mutations = append(skipped.Mutations, fmt.Sprintf("strip %s.%s %s", patch.path, patch.field, key))
+			}
+			patch.remove = nil
+		}
+		if categories.Contains(CategoryMandatory) {
+			for _, key := range mapset.Sorted(mapset.NewThreadUnsafeSetFromMapKeys(patch.add)) {
+				skipped.Mutations = append(skipped.Mutations, fmt.Sprintf("add %s.%s %s", patch.path, patch.field, key))
+			}
+			patch.add = map[string]string{}
+		}
+		if !patch.isEmpty() {
+			kept = append(kept, patch)
+		}
+	}
+
+	return kept, skipped
+}
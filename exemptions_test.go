@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
+)
+
+func TestExemptionMatchesUsers(t *testing.T) {
+	exemption := Exemption{}
+	if err := json.Unmarshal([]byte(`{
+		"usernames": [ "admin-*" ],
+		"groups": [ "system:masters" ],
+		"service_accounts": [ "argocd/*" ]
+	}`), &exemption); err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	cases := []struct {
+		user     kubewarden_protocol.UserInfo
+		expected bool
+	}{
+		{kubewarden_protocol.UserInfo{Username: "admin-alice"}, true},
+		{kubewarden_protocol.UserInfo{Username: "bob", Groups: []string{"system:masters"}}, true},
+		{kubewarden_protocol.UserInfo{Username: "system:serviceaccount:argocd:argocd-application-controller"}, true},
+		{kubewarden_protocol.UserInfo{Username: "system:serviceaccount:default:argocd"}, false},
+		{kubewarden_protocol.UserInfo{Username: "bob", Groups: []string{"system:authenticated"}}, false},
+	}
+
+	for _, tc := range cases {
+		if matched := exemption.matches(tc.user); matched != tc.expected {
+			t.Errorf("%+v: expected %t, got %t", tc.user, tc.expected, matched)
+		}
+	}
+}
+
+func TestApplyExemptions(t *testing.T) {
+	report := Report{}
+	report.add(
+		newViolation(CategoryMandatory, "metadata", "annotations", "team", literalKeyPattern("team")),
+		newViolation(CategoryDenied, "metadata", "annotations", "owner", literalKeyPattern("owner")),
+	)
+	patches := []metadataPatch{
+		{path: "metadata", field: "annotations", remove: []string{"foo"}, add: map[string]string{"cost-center": "cc-0000"}},
+	}
+
+	categories, _ := (&Settings{Exemptions: []Exemption{{
+		Usernames:  []*KeyPattern{literalKeyPattern("alice")},
+		Categories: []Category{CategoryDenied},
+	}}}).exemptCategories(kubewarden_protocol.UserInfo{Username: "alice"})
+
+	patches, skipped := applyExemptions(&report, patches, categories)
+
+	if len(report.Violations) != 1 || report.Violations[0].Key != "team" {
+		t.Errorf("Unexpected violations: %+v", report.Violations)
+	}
+	if len(skipped.Violations) != 1 || skipped.Violations[0].Key != "owner" {
+		t.Errorf("Unexpected skipped violations: %+v", skipped.Violations)
+	}
+	if len(skipped.Mutations) != 1 || skipped.Mutations[0] != "strip metadata.annotations foo" {
+		t.Errorf("Unexpected skipped mutations: %+v", skipped.Mutations)
+	}
+	if len(patches) != 1 || len(patches[0].remove) != 0 || patches[0].add["cost-center"] != "cc-0000" {
+		t.Errorf("Unexpected patches: %+v", patches)
+	}
+}
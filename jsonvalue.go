@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/kubewarden/gjson"
+)
+
+// A check that parses the value before checking it. The violations of
+// the values that cannot be parsed are reported on their own.
+type parsingCheck interface {
+	valueCheck
+	// Returns the error found while parsing the value
+	parse(value string) error
+}
+
+// JSON document, checked against a JSON Schema subset and a list of
+// assertions
+type jsonCheck struct {
+	schema     *jsonSchema
+	assertions []jsonAssertion
+}
+
+func newJSONCheck(schema json.RawMessage, assertions []jsonAssertion) (valueCheck, error) {
+	c := jsonCheck{assertions: assertions}
+	if len(schema) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(schema))
+		decoder.DisallowUnknownFields()
+		c.schema = &jsonSchema{}
+		if err := decoder.Decode(c.schema); err != nil {
+			return nil, fmt.Errorf("invalid schema: %w", err)
+		}
+		if err := c.schema.validate(); err != nil {
+			return nil, fmt.Errorf("invalid schema: %w", err)
+		}
+	}
+	return c, nil
+}
+
+func (c jsonCheck) parse(value string) error {
+	var document interface{}
+	return decodeJSONValue(value, &document)
+}
+
+func (c jsonCheck) check(value string) string {
+	var document interface{}
+	if err := decodeJSONValue(value, &document); err != nil {
+		return fmt.Sprintf("must be valid JSON: %s", err)
+	}
+
+	if c.schema != nil {
+		if reason := c.schema.check(document, "$"); reason != "" {
+			return reason
+		}
+	}
+
+	for _, assertion := range c.assertions {
+		if reason := assertion.check(value); reason != "" {
+			return reason
+		}
+	}
+
+	return ""
+}
+
+func (c jsonCheck) String() string {
+	if c.schema == nil {
+		return "json"
+	}
+	return "json matching the schema"
+}
+
+// Decodes a single JSON document, keeping the numbers as json.Number
+func decodeJSONValue(value string, document *interface{}) error {
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.UseNumber()
+	if err := decoder.Decode(document); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return fmt.Errorf("unexpected data after the JSON document")
+	}
+	return nil
+}
+
+// A subset of JSON Schema. Unknown keywords are rejected together with
+// the settings, instead of being silently ignored.
+type jsonSchema struct {
+	Type                 string                 `json:"type"`
+	Enum                 []interface{}          `json:"enum"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	MinItems             *int                   `json:"minItems"`
+	MaxItems             *int                   `json:"maxItems"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+	Pattern              *RegularExpression     `json:"pattern"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+
+	// Annotations, ignored by the validation
+	Schema      string `json:"$schema"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+var jsonSchemaTypes = []string{"object", "array", "string", "number", "integer", "boolean", "null"}
+
+// Checks the schema itself
+func (s *jsonSchema) validate() error {
+	if s.Type != "" {
+		known := false
+		for _, schemaType := range jsonSchemaTypes {
+			known = known || s.Type == schemaType
+		}
+		if !known {
+			return fmt.Errorf("unknown type '%s'", s.Type)
+		}
+	}
+	for _, property := range s.Properties {
+		if err := property.validate(); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return s.Items.validate()
+	}
+	return nil
+}
+
+// Returns the reason why the document does not match the schema, an
+// empty string when it does. The path locates the document inside of the
+// annotation value.
+func (s *jsonSchema) check(document interface{}, path string) string {
+	if s.Type != "" && !jsonTypeMatches(s.Type, document) {
+		return fmt.Sprintf("%s must be of type %s", path, s.Type)
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, allowed := range s.Enum {
+			found = found || jsonEqual(allowed, document)
+		}
+		if !found {
+			return fmt.Sprintf("%s must be one of the enum values", path)
+		}
+	}
+
+	switch value := document.(type) {
+	case map[string]interface{}:
+		return s.checkObject(value, path)
+	case []interface{}:
+		if s.MinItems != nil && len(value) < *s.MinItems {
+			return fmt.Sprintf("%s must have at least %d items", path, *s.MinItems)
+		}
+		if s.MaxItems != nil && len(value) > *s.MaxItems {
+			return fmt.Sprintf("%s must have at most %d items", path, *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range value {
+				if reason := s.Items.check(item, fmt.Sprintf("%s[%d]", path, i)); reason != "" {
+					return reason
+				}
+			}
+		}
+	case string:
+		length := len([]rune(value))
+		if s.MinLength != nil && length < *s.MinLength {
+			return fmt.Sprintf("%s must be at least %d characters long", path, *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			return fmt.Sprintf("%s must be at most %d characters long", path, *s.MaxLength)
+		}
+		if s.Pattern != nil && !s.Pattern.MatchString(value) {
+			return fmt.Sprintf("%s must match '%s'", path, s.Pattern)
+		}
+	case json.Number:
+		number, err := value.Float64()
+		if err != nil {
+			return fmt.Sprintf("%s must be a number", path)
+		}
+		if s.Minimum != nil && number < *s.Minimum {
+			return fmt.Sprintf("%s must be at least %v", path, *s.Minimum)
+		}
+		if s.Maximum != nil && number > *s.Maximum {
+			return fmt.Sprintf("%s must be at most %v", path, *s.Maximum)
+		}
+	}
+
+	return ""
+}
+
+func (s *jsonSchema) checkObject(object map[string]interface{}, path string) string {
+	for _, property := range s.Required {
+		if _, found := object[property]; !found {
+			return fmt.Sprintf("%s.%s is required", path, property)
+		}
+	}
+
+	properties := make([]string, 0, len(object))
+	for property := range object {
+		properties = append(properties, property)
+	}
+	sort.Strings(properties)
+
+	for _, property := range properties {
+		schema, found := s.Properties[property]
+		if !found {
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				return fmt.Sprintf("%s.%s is not allowed", path, property)
+			}
+			continue
+		}
+		if reason := schema.check(object[property], path+"."+property); reason != "" {
+			return reason
+		}
+	}
+
+	return ""
+}
+
+func jsonTypeMatches(schemaType string, document interface{}) bool {
+	switch value := document.(type) {
+	case map[string]interface{}:
+		return schemaType == "object"
+	case []interface{}:
+		return schemaType == "array"
+	case string:
+		return schemaType == "string"
+	case bool:
+		return schemaType == "boolean"
+	case nil:
+		return schemaType == "null"
+	case json.Number:
+		if schemaType == "number" {
+			return true
+		}
+		number, err := value.Float64()
+		return schemaType == "integer" && err == nil && number == math.Trunc(number)
+	}
+	return false
+}
+
+// Compares two JSON values, numbers are compared by value
+func jsonEqual(a, b interface{}) bool {
+	aNumber, aIsNumber := jsonNumber(a)
+	bNumber, bIsNumber := jsonNumber(b)
+	if aIsNumber || bIsNumber {
+		return aIsNumber && bIsNumber && aNumber == bNumber
+	}
+
+	aJSON, aErr := json.Marshal(a)
+	bJSON, bErr := json.Marshal(b)
+	return aErr == nil && bErr == nil && bytes.Equal(aJSON, bJSON)
+}
+
+func jsonNumber(value interface{}) (float64, bool) {
+	switch number := value.(type) {
+	case json.Number:
+		f, err := number.Float64()
+		return f, err == nil
+	case float64:
+		return number, true
+	}
+	return 0, false
+}
+
+// An assertion on the JSON value of an annotation, the path uses the
+// gjson syntax:
+//
+//	{ "path": "Environment", "regex": "^(prod|dev)$" }
+type jsonAssertion struct {
+	Path string `json:"path"`
+	// Whether the path must exist, defaults to true
+	Exists *bool              `json:"exists"`
+	Equals *string            `json:"equals"`
+	Regex  *RegularExpression `json:"regex"`
+}
+
+func (a *jsonAssertion) UnmarshalJSON(data []byte) error {
+	type rawJSONAssertion jsonAssertion
+	raw := rawJSONAssertion{}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&raw); err != nil {
+		return fmt.Errorf("invalid assertion: %w", err)
+	}
+	if raw.Path == "" {
+		return fmt.Errorf("assertion without path: %s", string(data))
+	}
+	if raw.Exists != nil && !*raw.Exists && (raw.Equals != nil || raw.Regex != nil) {
+		return fmt.Errorf("assertion on a path that must not exist: %s", string(data))
+	}
+
+	*a = jsonAssertion(raw)
+	return nil
+}
+
+// Returns the reason why the document does not satisfy the assertion,
+// an empty string when it does
+func (a *jsonAssertion) check(document string) string {
+	result := gjson.Get(document, a.Path)
+
+	if a.Exists != nil && !*a.Exists {
+		if result.Exists() {
+			return fmt.Sprintf("%s must not be set", a.Path)
+		}
+		return ""
+	}
+
+	switch {
+	case !result.Exists():
+		return fmt.Sprintf("%s is required", a.Path)
+	case a.Equals != nil && result.String() != *a.Equals:
+		return fmt.Sprintf("%s must be '%s'", a.Path, *a.Equals)
+	case a.Regex != nil && !a.Regex.MatchString(result.String()):
+		return fmt.Sprintf("%s must match '%s'", a.Path, a.Regex)
+	}
+	return ""
+}
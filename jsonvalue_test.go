@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestJSONConstraints(t *testing.T) {
+	schema := `{
+		"type": "json",
+		"schema": {
+			"type": "object",
+			"required": ["team", "replicas"],
+			"additionalProperties": false,
+			"properties": {
+				"team": { "type": "string", "pattern": "^team-" },
+				"replicas": { "type": "integer", "minimum": 1, "maximum": 5 },
+				"tier": { "enum": ["gold", "silver"] },
+				"hosts": { "type": "array", "maxItems": 2, "items": { "type": "string", "minLength": 3 } }
+			}
+		}
+	}`
+	assertions := `{
+		"type": "json",
+		"assertions": [
+			{ "path": "Environment", "regex": "^(prod|dev)$" },
+			{ "path": "Owner.Team", "equals": "infra" },
+			{ "path": "Debug", "exists": false }
+		]
+	}`
+
+	cases := []struct {
+		spec   string
+		value  string
+		reason string
+	}{
+		{schema, `{"team": "team-a", "replicas": 2, "tier": "gold", "hosts": ["a.com"]}`, ""},
+		{schema, `{"team": "team-a"}`, "$.replicas is required"},
+		{schema, `{"team": "infra", "replicas": 2}`, "$.team must match '^team-'"},
+		{schema, `{"team": "team-a", "replicas": 2.5}`, "$.replicas must be of type integer"},
+		{schema, `{"team": "team-a", "replicas": 6}`, "$.replicas must be at most 5"},
+		{schema, `{"team": "team-a", "replicas": 2, "tier": "bronze"}`, "$.tier must be one of the enum values"},
+		{schema, `{"team": "team-a", "replicas": 2, "hosts": ["a.com", "b"]}`, "$.hosts[1] must be at least 3 characters long"},
+		{schema, `{"team": "team-a", "replicas": 2, "owner": "x"}`, "$.owner is not allowed"},
+		{schema, `["team-a"]`, "$ must be of type object"},
+		{schema, `{"team": "team-a",}`, "must be valid JSON: invalid character '}' looking for beginning of object key string"},
+		{schema, `{} {}`, "must be valid JSON: unexpected data after the JSON document"},
+		{assertions, `{"Environment": "prod", "Owner": {"Team": "infra"}}`, ""},
+		{assertions, `{"Environment": "staging", "Owner": {"Team": "infra"}}`, "Environment must match '^(prod|dev)$'"},
+		{assertions, `{"Environment": "dev"}`, "Owner.Team is required"},
+		{assertions, `{"Environment": "dev", "Owner": {"Team": "web"}}`, "Owner.Team must be 'infra'"},
+		{assertions, `{"Environment": "dev", "Owner": {"Team": "infra"}, "Debug": true}`, "Debug must not be set"},
+	}
+
+	for _, tc := range cases {
+		check := compileTypedConstraint(t, tc.spec)
+		if reason := check.check(tc.value); reason != tc.reason {
+			t.Errorf("Value '%s': expected reason '%s', got '%s'", tc.value, tc.reason, reason)
+		}
+	}
+}
+
+func TestInvalidJSONConstraints(t *testing.T) {
+	cases := []string{
+		`{"type": "yaml"}`,
+		`{"type": "json", "schema": {"type": "map"}}`,
+		`{"type": "json", "schema": {"format": "email"}}`,
+		`{"type": "json", "schema": {"properties": {"a": {"pattern": "("}}}}`,
+		`{"type": "json", "assertions": [{"regex": "^a$"}]}`,
+		`{"type": "json", "assertions": [{"path": "a", "exists": false, "equals": "b"}]}`,
+		`{"type": "int", "schema": {"type": "object"}}`,
+		`{"assertions": [{"path": "a"}]}`,
+	}
+
+	for _, spec := range cases {
+		entry := constraintEntry{}
+		if err := json.Unmarshal([]byte(spec), &entry); err == nil {
+			t.Errorf("Expected %s to be rejected", spec)
+		}
+	}
+}
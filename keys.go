@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Limits of the Kubernetes qualified names, like `example.com/name`
+const (
+	maxKeyPrefixLength = 253
+	maxKeyNameLength   = 63
+)
+
+var (
+	dns1123SubdomainRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+	keyNameCharsRegexp     = regexp.MustCompile(`^[-A-Za-z0-9_.]*$`)
+	keyNameEdgesRegexp     = regexp.MustCompile(`^[A-Za-z0-9](.*[A-Za-z0-9])?$`)
+)
+
+// The rules enforced on the syntax of the annotation keys. The checks
+// are enabled only when the settings define them:
+//
+//	{
+//	   "allowed_prefixes": [ "*.example.com/", "kubernetes.io/" ],
+//	   "forbid_unprefixed": true
+//	}
+type KeySyntax struct {
+	// The prefixes that can be used by the keys, any valid prefix is
+	// allowed when empty. The trailing slash is optional.
+	AllowedPrefixes []*KeyPattern `json:"allowed_prefixes"`
+	// Reject the keys without a prefix
+	ForbidUnprefixed bool `json:"forbid_unprefixed"`
+}
+
+func (k *KeySyntax) UnmarshalJSON(data []byte) error {
+	rawKeySyntax := struct {
+		AllowedPrefixes  []string `json:"allowed_prefixes"`
+		ForbidUnprefixed bool     `json:"forbid_unprefixed"`
+	}{}
+
+	if err := json.Unmarshal(data, &rawKeySyntax); err != nil {
+		return err
+	}
+
+	prefixes := make([]string, 0, len(rawKeySyntax.AllowedPrefixes))
+	for _, prefix := range rawKeySyntax.AllowedPrefixes {
+		prefixes = append(prefixes, strings.TrimSuffix(prefix, "/"))
+	}
+	allowedPrefixes, err := compileKeyPatterns(prefixes)
+	if err != nil {
+		return err
+	}
+
+	k.AllowedPrefixes = allowedPrefixes
+	k.ForbidUnprefixed = rawKeySyntax.ForbidUnprefixed
+	return nil
+}
+
+// Checks the key against the Kubernetes qualified name syntax, and
+// against the allowed prefixes. Returns the violated rule and the reason,
+// empty strings when the key is valid.
+func (k *KeySyntax) check(key string) (rule, reason string) {
+	prefix, name, prefixed := strings.Cut(key, "/")
+
+	if !prefixed {
+		name = key
+		if k.ForbidUnprefixed {
+			return "forbid_unprefixed", "a prefix is required"
+		}
+	} else if reason := checkKeyPrefix(prefix); reason != "" {
+		return "qualified_name", reason
+	}
+
+	if reason := checkKeyName(name); reason != "" {
+		return "qualified_name", reason
+	}
+
+	if prefixed && len(k.AllowedPrefixes) > 0 && matchingKeyPattern(k.AllowedPrefixes, prefix) == nil {
+		return "allowed_prefixes", fmt.Sprintf("prefix '%s' is not allowed", prefix)
+	}
+
+	return "", ""
+}
+
+// Checks the prefix of a key, it must be a DNS-1123 subdomain
+func checkKeyPrefix(prefix string) string {
+	switch {
+	case prefix == "":
+		return "empty prefix"
+	case len(prefix) > maxKeyPrefixLength:
+		return fmt.Sprintf("prefix longer than %d characters", maxKeyPrefixLength)
+	case !dns1123SubdomainRegexp.MatchString(prefix):
+		return "prefix must be a lowercase DNS-1123 subdomain"
+	}
+	return ""
+}
+
+// Checks the name of a key, the part following the prefix
+func checkKeyName(name string) string {
+	switch {
+	case name == "":
+		return "empty name"
+	case len(name) > maxKeyNameLength:
+		return fmt.Sprintf("name longer than %d characters", maxKeyNameLength)
+	case !keyNameCharsRegexp.MatchString(name):
+		return "name can contain only alphanumeric characters and '-' '_' '.'"
+	case !keyNameEdgesRegexp.MatchString(name):
+		return "name must start and end with an alphanumeric character"
+	}
+	return ""
+}
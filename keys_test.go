@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestKeySyntax(t *testing.T) {
+	keySyntax := KeySyntax{}
+	if err := json.Unmarshal([]byte(`{
+		"allowed_prefixes": [ "*.example.com/", "kubernetes.io" ],
+		"forbid_unprefixed": true
+	}`), &keySyntax); err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	cases := []struct {
+		key    string
+		rule   string
+		reason string
+	}{
+		{"team.example.com/owner", "", ""},
+		{"kubernetes.io/description", "", ""},
+		{"kubernetes.io/a", "", ""},
+		{"owner", "forbid_unprefixed", "a prefix is required"},
+		{"example.com/owner", "allowed_prefixes", "prefix 'example.com' is not allowed"},
+		{"Team.example.com/owner", "qualified_name", "prefix must be a lowercase DNS-1123 subdomain"},
+		{"team..example.com/owner", "qualified_name", "prefix must be a lowercase DNS-1123 subdomain"},
+		{"/owner", "qualified_name", "empty prefix"},
+		{strings.Repeat("a", 250) + ".example.com/owner", "qualified_name", "prefix longer than 253 characters"},
+		{"team.example.com/", "qualified_name", "empty name"},
+		{"team.example.com/" + strings.Repeat("a", 64), "qualified_name", "name longer than 63 characters"},
+		{"team.example.com/owner/name", "qualified_name", "name can contain only alphanumeric characters and '-' '_' '.'"},
+		{"team.example.com/-owner", "qualified_name", "name must start and end with an alphanumeric character"},
+	}
+
+	for _, tc := range cases {
+		rule, reason := keySyntax.check(tc.key)
+		if rule != tc.rule || reason != tc.reason {
+			t.Errorf("%s: expected (%s, %s), got (%s, %s)", tc.key, tc.rule, tc.reason, rule, reason)
+		}
+	}
+}
+
+func TestKeySyntaxAllowsAnyPrefixByDefault(t *testing.T) {
+	keySyntax := KeySyntax{}
+	for _, key := range []string{"owner", "my.team.io/owner", "a_b.c-d"} {
+		if rule, reason := keySyntax.check(key); rule != "" {
+			t.Errorf("%s: unexpected violation of %s: %s", key, rule, reason)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Names of the settings limiting the whole annotations map, used as the
+// patterns of their violations
+const (
+	maxAnnotationsSetting      = "max_annotations"
+	maxAnnotationsBytesSetting = "max_annotations_bytes"
+)
+
+// A max_value_lengths entry, with its key compiled into a pattern
+type valueLengthLimit struct {
+	key   *KeyPattern
+	limit int
+}
+
+// Compiles the max_value_lengths setting, sorted by key so that the
+// violations are always found in the same order
+func compileValueLengthLimits(limits map[string]int) ([]valueLengthLimit, error) {
+	keys := make([]string, 0, len(limits))
+	for key := range limits {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	compiled := make([]valueLengthLimit, 0, len(keys))
+	for _, key := range keys {
+		if limits[key] <= 0 {
+			return nil, fmt.Errorf("the max_value_lengths limit of '%s' must be greater than zero", key)
+		}
+		pattern, err := CompileKeyPattern(key)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, valueLengthLimit{key: pattern, limit: limits[key]})
+	}
+	return compiled, nil
+}
+
+// Returns the value length limits matching the annotation that are
+// exceeded by a value of the given length
+func (r *RuleSet) exceededValueLengths(annotation string, length int) []valueLengthLimit {
+	exceeded := []valueLengthLimit{}
+	for _, limit := range r.valueLengthLimits {
+		if length > limit.limit && limit.key.Match(annotation) {
+			exceeded = append(exceeded, limit)
+		}
+	}
+	return exceeded
+}
+
+// Returns the violations of max_annotations and max_annotations_bytes,
+// given the number of annotations of the map and their size in bytes
+func (r *RuleSet) mapLimitViolations(metadataPath, field string, count, size int) []Violation {
+	violations := []Violation{}
+	for _, limit := range []struct {
+		setting string
+		limit   int
+		value   int
+	}{
+		{maxAnnotationsSetting, r.MaxAnnotations, count},
+		{maxAnnotationsBytesSetting, r.MaxAnnotationsBytes, size},
+	} {
+		if limit.limit == 0 || limit.value <= limit.limit {
+			continue
+		}
+		violation := newViolation(CategoryLimit, metadataPath, field, "", literalKeyPattern(limit.setting))
+		violation.Size = limit.value
+		violation.Limit = limit.limit
+		violations = append(violations, violation)
+	}
+	return violations
+}
+
+// Describes the values exceeding some length limits. The limits are
+// followed by their pattern, unless the annotation was matched only by
+// its name.
+func describeValueLengthViolations(violations []Violation) string {
+	limits := []string{}
+	for _, violation := range violations {
+		if violation.pattern.IsLiteral() {
+			limits = append(limits, fmt.Sprintf("limit %d", violation.Limit))
+		} else {
+			limits = append(limits, fmt.Sprintf("limit %d of '%s'", violation.Limit, violation.Pattern))
+		}
+	}
+	return fmt.Sprintf("%s (%d bytes, %s)", violations[0].Key, violations[0].Size, strings.Join(limits, ", "))
+}
+
+// Describes a violation of max_annotations or max_annotations_bytes
+func describeMapLimitViolation(violation Violation) string {
+	if violation.Pattern == maxAnnotationsSetting {
+		return fmt.Sprintf("Too many %s: %d, limit %d", violation.field, violation.Size, violation.Limit)
+	}
+	return fmt.Sprintf("The %s are too large: %d bytes, limit %d", violation.field, violation.Size, violation.Limit)
+}
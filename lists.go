@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The list options of a constrained_annotations entry. The value is split
+// by the separator, and the regular expression and the typed constraint
+// are applied to each of its elements:
+//
+//	{ "separator": ",", "type": "url", "max_items": 3, "unique": true }
+type listSpec struct {
+	Separator string `json:"separator"`
+	MinItems  *int   `json:"min_items"`
+	MaxItems  *int   `json:"max_items"`
+	Unique    bool   `json:"unique"`
+}
+
+// Returns the list options, nil when the entry does not define a
+// separator
+func (spec *listSpec) compile() (*listSpec, error) {
+	if spec.Separator == "" {
+		if spec.MinItems != nil || spec.MaxItems != nil || spec.Unique {
+			return nil, fmt.Errorf("min_items, max_items and unique require a separator")
+		}
+		return nil, nil
+	}
+
+	for _, bound := range []*int{spec.MinItems, spec.MaxItems} {
+		if bound != nil && *bound < 0 {
+			return nil, fmt.Errorf("min_items and max_items cannot be negative")
+		}
+	}
+	if spec.MinItems != nil && spec.MaxItems != nil && *spec.MinItems > *spec.MaxItems {
+		return nil, fmt.Errorf("min_items cannot be greater than max_items")
+	}
+
+	list := *spec
+	return &list, nil
+}
+
+// Splits the value into its elements, trimming the spaces around them.
+// A blank separator splits the value on any run of white spaces.
+func (spec *listSpec) split(value string) []string {
+	if strings.TrimSpace(spec.Separator) == "" {
+		return strings.Fields(value)
+	}
+
+	elements := strings.Split(value, spec.Separator)
+	for i, element := range elements {
+		elements[i] = strings.TrimSpace(element)
+	}
+	if len(elements) == 1 && elements[0] == "" {
+		return []string{}
+	}
+	return elements
+}
+
+// Returns the first element that does not satisfy the regular expression
+// or the typed constraint, together with the reason
+func invalidElement(elements []string, regex *RegularExpression, check valueCheck) (string, string, bool) {
+	for _, element := range elements {
+		if regex != nil && !regex.MatchString(element) {
+			return element, fmt.Sprintf("element '%s' must match '%s'", element, regex), true
+		}
+		if check != nil {
+			if reason := check.check(element); reason != "" {
+				return element, fmt.Sprintf("element '%s' %s", element, reason), true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// Returns the reason why the list does not satisfy the constraint, an
+// empty string when it does. The elements are checked before the size of
+// the list.
+func (spec *listSpec) check(value string, regex *RegularExpression, check valueCheck) string {
+	elements := spec.split(value)
+
+	if _, reason, found := invalidElement(elements, regex, check); found {
+		return reason
+	}
+
+	if spec.MinItems != nil && len(elements) < *spec.MinItems {
+		return fmt.Sprintf("must have at least %d elements", *spec.MinItems)
+	}
+	if spec.MaxItems != nil && len(elements) > *spec.MaxItems {
+		return fmt.Sprintf("must have at most %d elements", *spec.MaxItems)
+	}
+
+	if spec.Unique {
+		seen := map[string]bool{}
+		for _, element := range elements {
+			if seen[element] {
+				return fmt.Sprintf("element '%s' is repeated", element)
+			}
+			seen[element] = true
+		}
+	}
+
+	return ""
+}
+
+// Describes the list, like `list separated by ','`
+func (spec *listSpec) String() string {
+	if strings.TrimSpace(spec.Separator) == "" {
+		return "list separated by spaces"
+	}
+	return fmt.Sprintf("list separated by '%s'", spec.Separator)
+}
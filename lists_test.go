@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/kubewarden/gjson"
+)
+
+func TestListConstraints(t *testing.T) {
+	cases := []struct {
+		spec   string
+		value  string
+		reason string
+	}{
+		{`{"separator": ",", "type": "int"}`, "1, 2,3", ""},
+		{`{"separator": ",", "type": "int"}`, "1,two,3", "element 'two' must be an integer"},
+		{`{"separator": ",", "regex": "^[A-Z][a-zA-Z]+=(true|false)$"}`, "Prune=false,Validate=maybe", "element 'Validate=maybe' must match '^[A-Z][a-zA-Z]+=(true|false)$'"},
+		{`{"separator": " ", "regex": "^\\w+$"}`, "  a   b\tc ", ""},
+		{`{"separator": ",", "min_items": 1}`, "", "must have at least 1 elements"},
+		{`{"separator": ",", "max_items": 2}`, "a,b,c", "must have at most 2 elements"},
+		{`{"separator": ",", "unique": true}`, "a,b, a", "element 'a' is repeated"},
+		{`{"separator": ",", "regex": "^\\d+$"}`, "1,,2", "element '' must match '^\\d+$'"},
+		{`{"separator": ";", "type": "json", "schema": {"type": "object"}}`, `{"a": 1};[]`, "element '[]' $ must be of type object"},
+	}
+
+	for _, tc := range cases {
+		entry := constraintEntry{}
+		if err := json.Unmarshal([]byte(tc.spec), &entry); err != nil {
+			t.Fatalf("Unexpected error: %+v", err)
+		}
+		constraint := constrainedPattern{value: entry.Regex, check: entry.check, list: entry.list}
+		if _, reason := constraint.failure(tc.value, gjson.Result{}); reason != tc.reason {
+			t.Errorf("%s with value '%s': expected reason '%s', got '%s'", tc.spec, tc.value, tc.reason, reason)
+		}
+	}
+}
+
+func TestMalformedListElements(t *testing.T) {
+	entry := constraintEntry{}
+	if err := json.Unmarshal([]byte(`{"separator": ";", "type": "json"}`), &entry); err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	constraint := constrainedPattern{check: entry.check, list: entry.list}
+
+	if constraint.malformed(`{"a": 1};[]`) {
+		t.Error("Expected valid elements not to be malformed")
+	}
+	if !constraint.malformed(`{"a": 1};{`) {
+		t.Error("Expected invalid element to be malformed")
+	}
+}
+
+func TestInvalidListConstraints(t *testing.T) {
+	cases := []string{
+		`{"unique": true}`,
+		`{"regex": "^a$", "max_items": 2}`,
+		`{"separator": ",", "min_items": -1}`,
+		`{"separator": ",", "min_items": 3, "max_items": 2}`,
+		`{"separator": ",", "equals": "metadata.name"}`,
+	}
+
+	for _, spec := range cases {
+		entry := constraintEntry{}
+		if err := json.Unmarshal([]byte(spec), &entry); err == nil {
+			t.Errorf("Expected %s to be rejected", spec)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+)
+
+// The parts of the object whose metadata is validated
+type Location string
+
+const (
+	// The metadata of the object itself
+	LocationObject Location = "object"
+	// The metadata of the pod template embedded inside of workload
+	// controllers like Deployments and CronJobs
+	LocationPodTemplate Location = "pod_template"
+)
+
+// The metadata maps validated by the rules
+type Target string
+
+const (
+	TargetAnnotations Target = "annotations"
+	TargetLabels      Target = "labels"
+	TargetBoth        Target = "both"
+)
+
+// UnmarshalText satisfies the encoding.TextMarshaler interface,
+// also used by json.Unmarshal.
+func (t *Target) UnmarshalText(text []byte) error {
+	switch target := Target(text); target {
+	case TargetAnnotations, TargetLabels, TargetBoth:
+		*t = target
+		return nil
+	default:
+		return fmt.Errorf("unknown target '%s', must be one of '%s', '%s' or '%s'", target, TargetAnnotations, TargetLabels, TargetBoth)
+	}
+}
+
+// Returns the names of the metadata fields to validate, by default only
+// the annotations
+func (t Target) fields() []string {
+	switch t {
+	case TargetLabels:
+		return []string{"labels"}
+	case TargetBoth:
+		return []string{"annotations", "labels"}
+	default:
+		return []string{"annotations"}
+	}
+}
+
+// Path of the metadata of the object itself
+const objectMetadataPath = "metadata"
+
+// The API group and the kind of an object, the core group is ""
+type groupKind struct {
+	group, kind string
+}
+
+// Paths of the pod template metadata, by group and kind of the workload
+// controller. Custom resources reusing one of these kinds are not
+// workload controllers.
+var podTemplateMetadataPaths = map[groupKind]string{
+	{"apps", "Deployment"}:        "spec.template.metadata",
+	{"apps", "ReplicaSet"}:        "spec.template.metadata",
+	{"apps", "StatefulSet"}:       "spec.template.metadata",
+	{"apps", "DaemonSet"}:         "spec.template.metadata",
+	{"", "ReplicationController"}: "spec.template.metadata",
+	{"batch", "Job"}:              "spec.template.metadata",
+	{"batch", "CronJob"}:          "spec.jobTemplate.spec.template.metadata",
+}
+
+// UnmarshalText satisfies the encoding.TextMarshaler interface,
+// also used by json.Unmarshal.
+func (l *Location) UnmarshalText(text []byte) error {
+	switch location := Location(text); location {
+	case LocationObject, LocationPodTemplate:
+		*l = location
+		return nil
+	default:
+		return fmt.Errorf("unknown location '%s', must be either '%s' or '%s'", location, LocationObject, LocationPodTemplate)
+	}
+}
+
+// Returns the paths, inside of an object of the given group and kind, of
+// the metadata to validate
+func (s *Settings) metadataPaths(group, kind string) []string {
+	locations := s.Locations
+	if len(locations) == 0 {
+		locations = []Location{LocationObject}
+	}
+
+	paths := []string{}
+	for _, location := range locations {
+		switch location {
+		case LocationObject:
+			paths = append(paths, objectMetadataPath)
+		case LocationPodTemplate:
+			if path, found := podTemplateMetadataPaths[groupKind{group, kind}]; found {
+				paths = append(paths, path)
+			}
+		}
+	}
+	return paths
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"encoding/json"
+
+	kubewarden "github.com/kubewarden/policy-sdk-go"
+)
+
+// Sends the log events to the policy host
+var logWriter = &kubewarden.KubewardenLogWriter{}
+
+// Writes a structured log event. The fields are added to the event next
+// to the level and the message.
+func logEvent(level, message string, fields map[string]interface{}) {
+	event := map[string]interface{}{}
+	for key, value := range fields {
+		event[key] = value
+	}
+	event["level"] = level
+	event["message"] = message
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	_, _ = logWriter.Write(append(line, '\n'))
+}
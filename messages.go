@@ -0,0 +1,103 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"text/template"
+
+	"github.com/kubewarden/gjson"
+)
+
+// A user-defined rejection message, expressed using Go's text/template
+// syntax. The template is evaluated against messageData.
+type MessageTemplate struct {
+	*template.Template
+	raw string
+}
+
+// UnmarshalText satisfies the encoding.TextMarshaler interface,
+// also used by json.Unmarshal.
+func (m *MessageTemplate) UnmarshalText(text []byte) error {
+	tmpl, err := template.New("message").Parse(string(text))
+	if err != nil {
+		return err
+	}
+
+	// References to unknown fields are detected only when the template is
+	// executed, do that now to reject them together with the settings
+	if err := tmpl.Execute(io.Discard, messageData{}); err != nil {
+		return err
+	}
+
+	m.Template = tmpl
+	m.raw = string(text)
+	return nil
+}
+
+// MarshalText satisfies the encoding.TextMarshaler interface,
+// also used by json.Marshal.
+func (m *MessageTemplate) MarshalText() ([]byte, error) {
+	return []byte(m.raw), nil
+}
+
+// The custom message of a rule, shared by all the kinds of entries:
+//
+//	{
+//	   "message": "{{.Key}} must match {{.Expected}}, see {{.DocumentationURL}}",
+//	   "documentation_url": "https://wiki.example.com/annotations"
+//	}
+type ruleMessage struct {
+	Message          *MessageTemplate `json:"message"`
+	DocumentationURL string           `json:"documentation_url"`
+}
+
+// The values available to the message templates
+type messageData struct {
+	// The annotation, or label, key
+	Key string
+	// The value of the annotation, empty when it is missing
+	Value string
+	// The settings entry defining the rule
+	Pattern string
+	// The regular expression the value must match, or the description of
+	// its type, only for constrained annotations
+	Expected string
+	// Why the value does not satisfy the typed constraint
+	Reason string
+	// The kind, name and namespace of the object
+	Kind      string
+	Name      string
+	Namespace string
+	// The documentation URL of the rule
+	DocumentationURL string
+}
+
+// The attributes of the object being validated, used by the messages
+type objectInfo struct {
+	// The API group of the kind, the core group is ""
+	Group     string
+	Kind      string
+	Name      string
+	Namespace string
+
+	// The whole object, used by the references to its fields
+	raw gjson.Result
+}
+
+// Renders the custom message of the rule, returns an empty string when
+// the rule has no custom message
+func (m *ruleMessage) render(data messageData) string {
+	if m == nil || m.Message == nil {
+		return ""
+	}
+
+	data.DocumentationURL = m.DocumentationURL
+
+	var message strings.Builder
+	if err := m.Message.Execute(&message, data); err != nil {
+		// The template has been validated together with the settings,
+		// this should never happen
+		return err.Error()
+	}
+	return message.String()
+}
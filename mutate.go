@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// The changes to apply to one of the annotation, or label, maps of the
+// object being validated
+type metadataPatch struct {
+	// Path of the metadata holding the map, like `spec.template.metadata`
+	path string
+	// Name of the map inside of the metadata, either `annotations` or
+	// `labels`
+	field string
+	// Keys to remove
+	remove []string
+	// Keys to add, with their values
+	add map[string]string
+	// The violations fixed by the changes, reported instead of them by
+	// the rules in monitor mode
+	fixes []Violation
+}
+
+func (p *metadataPatch) isEmpty() bool {
+	return len(p.remove) == 0 && len(p.add) == 0
+}
+
+// Returns the violations fixed by the patches
+func patchFixes(patches []metadataPatch) Report {
+	report := Report{}
+	for _, patch := range patches {
+		report.add(patch.fixes...)
+	}
+	return report
+}
+
+// Returns a copy of the object with the patches applied. Numbers are
+// decoded as json.Number, so that they are serialized back unchanged.
+func applyPatches(object []byte, patches []metadataPatch) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(object))
+	decoder.UseNumber()
+
+	patched := map[string]interface{}{}
+	if err := decoder.Decode(&patched); err != nil {
+		return nil, err
+	}
+
+	for _, patch := range patches {
+		if err := patch.apply(patched); err != nil {
+			return nil, err
+		}
+	}
+
+	return patched, nil
+}
+
+func (p *metadataPatch) apply(object map[string]interface{}) error {
+	metadata := object
+	for _, field := range strings.Split(p.path, ".") {
+		if metadata[field] == nil {
+			metadata[field] = map[string]interface{}{}
+		}
+		var ok bool
+		metadata, ok = metadata[field].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("cannot patch object: %s is not an object", p.path)
+		}
+	}
+
+	if metadata[p.field] == nil {
+		metadata[p.field] = map[string]interface{}{}
+	}
+	entries, ok := metadata[p.field].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("cannot patch object: %s.%s is not an object", p.path, p.field)
+	}
+
+	for _, key := range p.remove {
+		delete(entries, key)
+	}
+	for key, value := range p.add {
+		entries[key] = value
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Prefix of the patterns that are regular expressions. Annotation keys
+// cannot contain a colon, hence the prefix cannot clash with a real key.
+const regexpKeyPatternPrefix = "re:"
+
+// KeyPattern matches annotation keys, and the other names referenced by
+// the settings, like kinds and namespaces. The pattern syntax is a glob:
+//
+//   - `*` matches any sequence of characters, including an empty one
+//   - `?` matches exactly one character
+//   - `\` escapes the character that follows it, so `\*` matches a
+//     literal `*` and `\\` matches a literal `\`
+//
+// A pattern without wildcards matches only the key spelled the same way.
+//
+// Patterns starting with `re:` are regular expressions, using Go's syntax,
+// that must match the whole key.
+type KeyPattern struct {
+	raw     string
+	literal string
+	re      *regexp.Regexp
+}
+
+// Convenience method to build a key pattern
+func CompileKeyPattern(pattern string) (*KeyPattern, error) {
+	if expr, found := strings.CutPrefix(pattern, regexpKeyPatternPrefix); found {
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+		return &KeyPattern{raw: pattern, re: re}, nil
+	}
+
+	var expr strings.Builder
+	var literal strings.Builder
+	wildcards := false
+
+	expr.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '\\':
+			if i+1 == len(pattern) {
+				return nil, fmt.Errorf("invalid pattern '%s': trailing escape character", pattern)
+			}
+			i++
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			literal.WriteByte(pattern[i])
+		case '*':
+			wildcards = true
+			expr.WriteString(".*")
+		case '?':
+			wildcards = true
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			literal.WriteByte(c)
+		}
+	}
+	expr.WriteString("$")
+
+	if !wildcards {
+		return &KeyPattern{raw: pattern, literal: literal.String()}, nil
+	}
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+	}
+	return &KeyPattern{raw: pattern, re: re}, nil
+}
+
+// Builds a pattern matching only the given key, wildcards included
+func literalKeyPattern(key string) *KeyPattern {
+	return &KeyPattern{raw: key, literal: key}
+}
+
+// Match reports whether the key is matched by the pattern
+func (p *KeyPattern) Match(key string) bool {
+	if p.re == nil {
+		return p.literal == key
+	}
+	return p.re.MatchString(key)
+}
+
+// IsLiteral reports whether the pattern matches only one key
+func (p *KeyPattern) IsLiteral() bool {
+	return p.re == nil
+}
+
+// Literal returns the only key matched by the pattern, the boolean
+// is false when the pattern can match more keys
+func (p *KeyPattern) Literal() (string, bool) {
+	return p.literal, p.re == nil
+}
+
+// String returns the pattern as written by the user
+func (p *KeyPattern) String() string {
+	return p.raw
+}
+
+// UnmarshalText satisfies the encoding.TextMarshaler interface,
+// also used by json.Unmarshal.
+func (p *KeyPattern) UnmarshalText(text []byte) error {
+	pattern, err := CompileKeyPattern(string(text))
+	if err != nil {
+		return err
+	}
+	*p = *pattern
+	return nil
+}
+
+// MarshalText satisfies the encoding.TextMarshaler interface,
+// also used by json.Marshal.
+func (p *KeyPattern) MarshalText() ([]byte, error) {
+	return []byte(p.raw), nil
+}
+
+// Compiles a list of patterns, stopping at the first invalid one
+func compileKeyPatterns(patterns []string) ([]*KeyPattern, error) {
+	compiled := make([]*KeyPattern, 0, len(patterns))
+	for _, pattern := range patterns {
+		p, err := CompileKeyPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, p)
+	}
+	return compiled, nil
+}
+
+// Returns the first pattern matching the key, nil when none matches
+func matchingKeyPattern(patterns []*KeyPattern, key string) *KeyPattern {
+	for _, p := range patterns {
+		if p.Match(key) {
+			return p
+		}
+	}
+	return nil
+}
+
+// Parses a list of key patterns, one per line. Empty lines and lines
+// starting with `#` are ignored.
+func parseKeyPatternList(data string) ([]*KeyPattern, error) {
+	patterns := []string{}
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return compileKeyPatterns(patterns)
+}
+
+func mustParseKeyPatternList(data string) []*KeyPattern {
+	patterns, err := parseKeyPatternList(data)
+	if err != nil {
+		panic(err)
+	}
+	return patterns
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+)
+
+// A named set of built-in rules, enabled by the settings
+type Profile string
+
+const (
+	// Denies the snippet annotations of ingress-nginx
+	ProfileIngressNginxSnippets Profile = "ingress-nginx-snippets"
+	// Allows the snippet annotations of ingress-nginx, as long as they do
+	// not use dangerous directives
+	ProfileIngressNginxRestrictedSnippets Profile = "ingress-nginx-restricted-snippets"
+)
+
+var profiles = []Profile{
+	ProfileIngressNginxSnippets,
+	ProfileIngressNginxRestrictedSnippets,
+}
+
+// UnmarshalText satisfies the encoding.TextMarshaler interface,
+// also used by json.Unmarshal.
+func (p *Profile) UnmarshalText(text []byte) error {
+	for _, profile := range profiles {
+		if Profile(text) == profile {
+			*p = profile
+			return nil
+		}
+	}
+
+	names := []string{}
+	for _, profile := range profiles {
+		names = append(names, fmt.Sprintf("'%s'", profile))
+	}
+	return fmt.Errorf("unknown profile '%s', must be one of %s", text, strings.Join(names, ", "))
+}
+
+// The snippet annotations of ingress-nginx, like
+// `nginx.ingress.kubernetes.io/configuration-snippet`
+const ingressNginxSnippetsPattern = "nginx.ingress.kubernetes.io/*-snippet"
+
+// The directives that cannot be used by the restricted snippets, shipped
+// with the policy
+//
+//go:embed data/nginx_snippet_directives.txt
+var forbiddenSnippetDirectivesData string
+
+var forbiddenSnippetDirectives = mustParseKeyPatternList(forbiddenSnippetDirectivesData)
+
+// Paths that cannot be referenced by the restricted snippets, whatever
+// the directive: they hold the credentials of the controller
+var forbiddenSnippetPaths = []string{
+	"/var/run/secrets",
+	"/run/secrets",
+	"/etc/nginx",
+	"/etc/ingress-controller",
+}
+
+// Adds the rules of the profiles to the RuleSet
+func (r *RuleSet) applyProfiles() error {
+	enabled := map[Profile]bool{}
+	for _, profile := range r.Profiles {
+		enabled[profile] = true
+	}
+	if enabled[ProfileIngressNginxSnippets] && enabled[ProfileIngressNginxRestrictedSnippets] {
+		return fmt.Errorf("profiles %s and %s cannot be used together",
+			ProfileIngressNginxSnippets, ProfileIngressNginxRestrictedSnippets)
+	}
+
+	pattern, err := CompileKeyPattern(ingressNginxSnippetsPattern)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case enabled[ProfileIngressNginxSnippets]:
+		r.DeniedAnnotations.Add(ingressNginxSnippetsPattern)
+		r.deniedPatterns = append(r.deniedPatterns, deniedEntry{KeyPattern: pattern, action: r.Action})
+	case enabled[ProfileIngressNginxRestrictedSnippets]:
+		r.constrainedPatterns = append(r.constrainedPatterns, constrainedPattern{
+			key:   pattern,
+			check: nginxSnippetCheck{},
+		})
+	}
+
+	return nil
+}
+
+// nginx configuration that does not use the forbidden directives, nor
+// references the forbidden paths
+type nginxSnippetCheck struct{}
+
+func (nginxSnippetCheck) check(value string) string {
+	for _, directive := range nginxDirectives(value) {
+		if matchingKeyPattern(forbiddenSnippetDirectives, directive) != nil {
+			return fmt.Sprintf("uses the forbidden directive '%s'", directive)
+		}
+	}
+	for _, path := range forbiddenSnippetPaths {
+		if strings.Contains(value, path) {
+			return fmt.Sprintf("references the forbidden path '%s'", path)
+		}
+	}
+	return ""
+}
+
+func (nginxSnippetCheck) String() string {
+	return "nginx configuration without forbidden directives"
+}
+
+// Returns the names of the directives used by the nginx configuration,
+// lowercase and in order of appearance. The names are the first words of
+// the statements, which are terminated by `;`, `{` and `}`. Comments and
+// quoted strings are skipped.
+func nginxDirectives(config string) []string {
+	directives := []string{}
+	statementStart := true
+
+	for i := 0; i < len(config); {
+		c := config[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '#':
+			for i < len(config) && config[i] != '\n' {
+				i++
+			}
+		case c == ';' || c == '{' || c == '}':
+			statementStart = true
+			i++
+		case c == '"' || c == '\'':
+			// Quoted strings end at the first unescaped quote, nginx
+			// accepts quoted directive names too
+			var token strings.Builder
+			i++
+			for i < len(config) && config[i] != c {
+				if config[i] == '\\' && i+1 < len(config) {
+					i++
+				}
+				token.WriteByte(config[i])
+				i++
+			}
+			i++
+			if statementStart {
+				directives = append(directives, strings.ToLower(token.String()))
+			}
+			statementStart = false
+		default:
+			start := i
+			for i < len(config) && !strings.ContainsRune(" \t\n\r;{}\"'", rune(config[i])) {
+				if config[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if statementStart {
+				directives = append(directives, strings.ToLower(config[start:min(i, len(config))]))
+			}
+			statementStart = false
+		}
+	}
+
+	return directives
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNginxDirectives(t *testing.T) {
+	config := `
+		# comment; alias /etc;
+		more_set_headers "X-Test: a;b" ;
+		location /x { Root /; if ($a) { return 403; } }
+		'set' $a "\"; alias";
+	`
+	expected := []string{"more_set_headers", "location", "root", "if", "return", "set"}
+
+	directives := nginxDirectives(config)
+	if strings.Join(directives, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected directives %v, got %v", expected, directives)
+	}
+}
+
+// The snippets of the corpus under test_data/nginx-snippets. The forbidden
+// ones start with an `# expect: <reason>` comment.
+func TestNginxSnippetCorpus(t *testing.T) {
+	for _, dir := range []string{"allowed", "forbidden"} {
+		files, err := filepath.Glob(filepath.Join("test_data", "nginx-snippets", dir, "*.conf"))
+		if err != nil || len(files) == 0 {
+			t.Fatalf("Cannot list the %s snippets: %+v", dir, err)
+		}
+
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatalf("Cannot read %s: %+v", file, err)
+			}
+			snippet := string(data)
+
+			expected := ""
+			if dir == "forbidden" {
+				firstLine, _, _ := strings.Cut(snippet, "\n")
+				expected = strings.TrimPrefix(firstLine, "# expect: ")
+			}
+			if reason := (nginxSnippetCheck{}).check(snippet); reason != expected {
+				t.Errorf("%s: expected reason '%s', got '%s'", file, expected, reason)
+			}
+		}
+	}
+}
+
+func TestInvalidProfiles(t *testing.T) {
+	cases := []string{
+		`{"profiles": ["ingress-nginx"]}`,
+		`{"profiles": ["ingress-nginx-snippets", "ingress-nginx-restricted-snippets"]}`,
+	}
+
+	for _, settingsJSON := range cases {
+		settings := Settings{}
+		if err := json.Unmarshal([]byte(settingsJSON), &settings); err == nil {
+			t.Errorf("Expected %s to be rejected", settingsJSON)
+		}
+	}
+}
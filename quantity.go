@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Multipliers of the suffixes of Kubernetes quantities
+var quantitySuffixes = map[string]*big.Rat{
+	"":   big.NewRat(1, 1),
+	"m":  big.NewRat(1, 1000),
+	"k":  big.NewRat(1000, 1),
+	"M":  big.NewRat(1000*1000, 1),
+	"G":  new(big.Rat).SetFloat64(1e9),
+	"T":  new(big.Rat).SetFloat64(1e12),
+	"P":  new(big.Rat).SetFloat64(1e15),
+	"E":  new(big.Rat).SetFloat64(1e18),
+	"Ki": big.NewRat(1<<10, 1),
+	"Mi": big.NewRat(1<<20, 1),
+	"Gi": big.NewRat(1<<30, 1),
+	"Ti": big.NewRat(1<<40, 1),
+	"Pi": big.NewRat(1<<50, 1),
+	"Ei": big.NewRat(1<<60, 1),
+}
+
+// Parses a Kubernetes resource quantity, like `500Mi`, `1.5` or `2e3`,
+// into its exact value
+func parseQuantity(quantity string) (*big.Rat, error) {
+	invalid := fmt.Errorf("'%s' is not a quantity", quantity)
+
+	// Split the signed number from its suffix
+	end := 0
+	if end < len(quantity) && (quantity[end] == '+' || quantity[end] == '-') {
+		end++
+	}
+	digits := 0
+	for end < len(quantity) && (quantity[end] >= '0' && quantity[end] <= '9' || quantity[end] == '.') {
+		if quantity[end] != '.' {
+			digits++
+		}
+		end++
+	}
+	if digits == 0 || strings.Count(quantity[:end], ".") > 1 {
+		return nil, invalid
+	}
+
+	number, ok := new(big.Rat).SetString(quantity[:end])
+	if !ok {
+		return nil, invalid
+	}
+
+	suffix := quantity[end:]
+	if multiplier, found := quantitySuffixes[suffix]; found {
+		return number.Mul(number, multiplier), nil
+	}
+
+	// Decimal exponent, like 2e3 or 1E-3
+	if suffix[0] != 'e' && suffix[0] != 'E' {
+		return nil, invalid
+	}
+	exponent, ok := new(big.Rat).SetString("1" + suffix)
+	if !ok || !strings.ContainsAny(suffix[1:], "0123456789") || strings.Contains(suffix, ".") {
+		return nil, invalid
+	}
+	return number.Mul(number, exponent), nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kubewarden/gjson"
+)
+
+// A reference from the value of an annotation to other fields of the
+// object, like its labels or its name. Paths use the gjson syntax, and
+// are relative to request.object.
+type fieldReference struct {
+	// The value must be equal to the field at this path
+	path string
+	// The value must be equal to this format, once its `${path}`
+	// placeholders are replaced with the referenced fields
+	format string
+	// The paths referenced by the format
+	formatPaths []string
+}
+
+func newFieldReference(equals, format string) (*fieldReference, error) {
+	switch {
+	case equals != "" && format != "":
+		return nil, fmt.Errorf("equals and format cannot be used together")
+	case equals != "":
+		return &fieldReference{path: equals}, nil
+	case format != "":
+		paths, err := parseFormatPaths(format)
+		if err != nil {
+			return nil, err
+		}
+		return &fieldReference{format: format, formatPaths: paths}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// Returns the paths of the `${path}` placeholders of the format
+func parseFormatPaths(format string) ([]string, error) {
+	paths := []string{}
+	rest := format
+	for {
+		start := strings.Index(rest, "${")
+		if start == -1 {
+			break
+		}
+		end := strings.Index(rest[start:], "}")
+		if end == -1 {
+			return nil, fmt.Errorf("invalid format '%s': unclosed placeholder", format)
+		}
+		path := rest[start+2 : start+end]
+		if path == "" {
+			return nil, fmt.Errorf("invalid format '%s': empty placeholder", format)
+		}
+		paths = append(paths, path)
+		rest = rest[start+end+1:]
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("invalid format '%s': no ${path} placeholder", format)
+	}
+	return paths, nil
+}
+
+// Returns the value expected by the reference. The second value is the
+// first referenced path missing from the object, if any.
+func (f *fieldReference) expected(object gjson.Result) (string, string) {
+	if f.path != "" {
+		field := object.Get(f.path)
+		if !field.Exists() {
+			return "", f.path
+		}
+		return field.String(), ""
+	}
+
+	expected := f.format
+	for _, path := range f.formatPaths {
+		field := object.Get(path)
+		if !field.Exists() {
+			return "", path
+		}
+		expected = strings.Replace(expected, "${"+path+"}", field.String(), 1)
+	}
+	return expected, ""
+}
+
+// Returns the reason why the value does not satisfy the reference, an
+// empty string when it does. References are not checked without an
+// object, like when the settings are validated.
+func (f *fieldReference) check(value string, object gjson.Result) string {
+	if !object.Exists() {
+		return ""
+	}
+
+	expected, missing := f.expected(object)
+	switch {
+	case missing != "":
+		return fmt.Sprintf("references the missing field %s", missing)
+	case value == expected:
+		return ""
+	// The referenced fields are never printed, they can hold secrets
+	case f.path != "":
+		return fmt.Sprintf("must be equal to %s", f.path)
+	default:
+		return fmt.Sprintf("must be derived from '%s'", f.format)
+	}
+}
+
+// Describes the values accepted by the reference
+func (f *fieldReference) String() string {
+	if f.path != "" {
+		return fmt.Sprintf("equal to %s", f.path)
+	}
+	return fmt.Sprintf("derived from '%s'", f.format)
+}
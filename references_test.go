@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/kubewarden/gjson"
+)
+
+func TestFieldReferences(t *testing.T) {
+	object := gjson.Parse(`{
+		"metadata": {
+			"name": "nginx",
+			"namespace": "team-a",
+			"labels": { "team": "infra", "app.kubernetes.io/name": "web" }
+		}
+	}`)
+
+	cases := []struct {
+		equals, format string
+		value          string
+		reason         string
+	}{
+		{"metadata.name", "", "nginx", ""},
+		{"metadata.labels.team", "", "team-infra", "must be equal to metadata.labels.team"},
+		{"metadata.labels.app\\.kubernetes\\.io/name", "", "web", ""},
+		{"metadata.labels.owner", "", "infra", "references the missing field metadata.labels.owner"},
+		{"", "team-${metadata.labels.team}", "team-infra", ""},
+		{"", "${metadata.namespace}/${metadata.name}", "team-a/nginx", ""},
+		{"", "${metadata.namespace}/${metadata.name}", "nginx", "must be derived from '${metadata.namespace}/${metadata.name}'"},
+	}
+
+	for _, tc := range cases {
+		reference, err := newFieldReference(tc.equals, tc.format)
+		if err != nil {
+			t.Fatalf("Unexpected error: %+v", err)
+		}
+		if reason := reference.check(tc.value, object); reason != tc.reason {
+			t.Errorf("%s%s with value '%s': expected reason '%s', got '%s'", tc.equals, tc.format, tc.value, tc.reason, reason)
+		}
+	}
+}
+
+func TestInvalidFieldReferences(t *testing.T) {
+	cases := []struct{ equals, format string }{
+		{"metadata.name", "${metadata.name}"},
+		{"", "team-${metadata.labels.team"},
+		{"", "team-${}"},
+		{"", "team"},
+	}
+
+	for _, tc := range cases {
+		if _, err := newFieldReference(tc.equals, tc.format); err == nil {
+			t.Errorf("Expected equals '%s' and format '%s' to be rejected", tc.equals, tc.format)
+		}
+	}
+}
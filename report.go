@@ -0,0 +1,350 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The kind of rule that has been violated
+type Category string
+
+const (
+	CategoryDenied      Category = "denied"
+	CategorySyntax      Category = "syntax"
+	CategoryReserved    Category = "reserved"
+	CategoryConstrained Category = "constrained"
+	CategoryMalformed   Category = "malformed"
+	CategoryLength      Category = "length"
+	CategorySecret      Category = "secret"
+	CategoryMandatory   Category = "mandatory"
+	CategoryDependency  Category = "dependency"
+	CategoryExclusive   Category = "exclusive"
+	CategoryImmutable   Category = "immutable"
+	CategoryLimit       Category = "limit"
+)
+
+// The order used to report the categories inside of the messages
+var categoriesOrder = []Category{
+	CategoryDenied,
+	CategorySyntax,
+	CategoryReserved,
+	CategoryConstrained,
+	CategoryMalformed,
+	CategoryLength,
+	CategorySecret,
+	CategoryMandatory,
+	CategoryDependency,
+	CategoryExclusive,
+	CategoryImmutable,
+	CategoryLimit,
+}
+
+// UnmarshalText satisfies the encoding.TextMarshaler interface,
+// also used by json.Unmarshal.
+func (c *Category) UnmarshalText(text []byte) error {
+	for _, category := range categoriesOrder {
+		if Category(text) == category {
+			*c = category
+			return nil
+		}
+	}
+
+	names := []string{}
+	for _, category := range categoriesOrder {
+		names = append(names, fmt.Sprintf("'%s'", category))
+	}
+	return fmt.Errorf("unknown category '%s', must be one of %s", text, strings.Join(names, ", "))
+}
+
+// A single rule violation found on the object
+type Violation struct {
+	// Identifies the rule that has been violated, it is made by the
+	// category and by the settings entry defining the rule, like
+	// `denied/nginx.ingress.kubernetes.io/*-snippet`
+	RuleID   string   `json:"rule_id"`
+	Category Category `json:"category"`
+	// Path of the annotations, or labels, map where the violation has
+	// been found, like `metadata.annotations`
+	Path string `json:"path"`
+	Key  string `json:"key"`
+	// The settings entry defining the rule
+	Pattern string `json:"pattern"`
+	// The custom message of the rule, empty when the rule does not have
+	// one
+	Message string `json:"message,omitempty"`
+	// Only for typed constraints, key syntax, dependencies and exclusive
+	// groups, why the annotation has been rejected. For the changes of the
+	// rules in monitor mode, the change that would have been made
+	Reason string `json:"reason,omitempty"`
+	// Only for size limits, the measured size and the limit it exceeds.
+	// Sizes are in bytes, except for max_annotations
+	Size  int `json:"size,omitempty"`
+	Limit int `json:"limit,omitempty"`
+	// Only for immutable annotations, nil when the annotation has been
+	// removed
+	Value    *string `json:"value,omitempty"`
+	OldValue *string `json:"old_value,omitempty"`
+
+	// The location and the field making the path
+	location string
+	field    string
+	pattern  *KeyPattern
+	// Only for dependencies, the condition that triggered them
+	condition string
+}
+
+func newViolation(category Category, location, field, key string, pattern *KeyPattern) Violation {
+	return Violation{
+		RuleID:   fmt.Sprintf("%s/%s", category, pattern),
+		Category: category,
+		Path:     fmt.Sprintf("%s.%s", location, field),
+		Key:      key,
+		Pattern:  pattern.String(),
+		location: location,
+		field:    field,
+		pattern:  pattern,
+	}
+}
+
+// Returns the values available to the custom message of the violation
+func (v *Violation) messageData(object objectInfo, value, expected string) messageData {
+	return messageData{
+		Key:       v.Key,
+		Value:     value,
+		Pattern:   v.Pattern,
+		Expected:  expected,
+		Reason:    v.Reason,
+		Kind:      object.Kind,
+		Name:      object.Name,
+		Namespace: object.Namespace,
+	}
+}
+
+// All the violations found on the object, sorted by location, field,
+// category, key and rule ID
+type Report struct {
+	Violations []Violation `json:"violations"`
+}
+
+func (r *Report) add(violations ...Violation) {
+	r.Violations = append(r.Violations, violations...)
+}
+
+func (r *Report) isEmpty() bool {
+	return len(r.Violations) == 0
+}
+
+// Returns a new report with the violations of r that are not reported by
+// other
+func (r *Report) without(other *Report) Report {
+	type violationID struct {
+		path, key, ruleID string
+	}
+	found := map[violationID]bool{}
+	for _, violation := range other.Violations {
+		found[violationID{violation.Path, violation.Key, violation.RuleID}] = true
+	}
+
+	report := Report{}
+	for _, violation := range r.Violations {
+		if !found[violationID{violation.Path, violation.Key, violation.RuleID}] {
+			report.add(violation)
+		}
+	}
+	return report
+}
+
+func categoryIndex(category Category) int {
+	for i, c := range categoriesOrder {
+		if c == category {
+			return i
+		}
+	}
+	return len(categoriesOrder)
+}
+
+// Sorts the violations, so that the same object always produces the
+// same report
+func (r *Report) sort() {
+	sort.SliceStable(r.Violations, func(i, j int) bool {
+		a, b := r.Violations[i], r.Violations[j]
+		if a.location != b.location {
+			// The object metadata is always reported first
+			if a.location == objectMetadataPath || b.location == objectMetadataPath {
+				return a.location == objectMetadataPath
+			}
+			return a.location < b.location
+		}
+		if a.field != b.field {
+			return a.field < b.field
+		}
+		if a.Category != b.Category {
+			return categoryIndex(a.Category) < categoryIndex(b.Category)
+		}
+		if a.Key != b.Key {
+			return a.Key < b.Key
+		}
+		return a.RuleID < b.RuleID
+	})
+}
+
+// JSON returns the machine readable form of the report
+func (r *Report) JSON() ([]byte, error) {
+	r.sort()
+	return json.Marshal(r)
+}
+
+// Message returns the human readable form of the report. Violations of
+// the same category are reported together, followed by the custom
+// messages of the violated rules. Violations found outside of the object
+// metadata are prefixed by their path.
+func (r *Report) Message() string {
+	r.sort()
+
+	msgs := []string{}
+	for start := 0; start < len(r.Violations); {
+		end := start
+		for end < len(r.Violations) &&
+			r.Violations[end].Path == r.Violations[start].Path &&
+			r.Violations[end].Category == r.Violations[start].Category {
+			end++
+		}
+
+		prefix := ""
+		if r.Violations[start].location != objectMetadataPath {
+			prefix = r.Violations[start].Path + ": "
+		}
+
+		withoutMessage := []Violation{}
+		customMessages := []string{}
+		for _, violation := range r.Violations[start:end] {
+			if violation.Message == "" {
+				withoutMessage = append(withoutMessage, violation)
+			} else {
+				customMessages = append(customMessages, prefix+violation.Message)
+			}
+		}
+
+		if len(withoutMessage) > 0 {
+			msgs = append(msgs, prefix+describeViolations(withoutMessage))
+		}
+		msgs = append(msgs, customMessages...)
+
+		start = end
+	}
+
+	return strings.Join(msgs, ". ")
+}
+
+// Describes violations sharing the same path and category
+func describeViolations(violations []Violation) string {
+	category := violations[0].Category
+	field := violations[0].field
+
+	// Violations are sorted by key, the ones of the same key are
+	// described together
+	entries := []string{}
+	for start := 0; start < len(violations); {
+		end := start
+		for end < len(violations) && violations[end].Key == violations[start].Key {
+			end++
+		}
+		entries = append(entries, describeKeyViolations(violations[start:end]))
+		start = end
+	}
+
+	switch category {
+	case CategoryDenied:
+		return fmt.Sprintf("The following %s are not allowed: %s", field, strings.Join(entries, ","))
+	case CategorySyntax:
+		return fmt.Sprintf("The following %s have invalid keys: %s", field, strings.Join(entries, ","))
+	case CategoryReserved:
+		return fmt.Sprintf("The following %s are using reserved prefixes: %s", field, strings.Join(entries, ","))
+	case CategoryConstrained:
+		return fmt.Sprintf("The following %s are violating user constraints: %s", field, strings.Join(entries, ","))
+	case CategoryMalformed:
+		return fmt.Sprintf("The values of the following %s cannot be parsed: %s", field, strings.Join(entries, ","))
+	case CategoryLength:
+		return fmt.Sprintf("The values of the following %s are too long: %s", field, strings.Join(entries, ","))
+	case CategorySecret:
+		return fmt.Sprintf("The values of the following %s look like secrets: %s", field, strings.Join(entries, ","))
+	case CategoryMandatory:
+		return fmt.Sprintf("The following mandatory %s are missing: %s", field, strings.Join(entries, ","))
+	case CategoryDependency:
+		return fmt.Sprintf("The following %s do not satisfy their dependencies: %s", field, strings.Join(entries, ","))
+	case CategoryExclusive:
+		return fmt.Sprintf("The following exclusive %s are conflicting: %s", field, strings.Join(entries, ","))
+	case CategoryImmutable:
+		return fmt.Sprintf("The following immutable %s cannot be changed: %s", field, strings.Join(entries, ","))
+	case CategoryLimit:
+		return strings.Join(entries, ". ")
+	default:
+		return fmt.Sprintf("The following %s are not valid: %s", field, strings.Join(entries, ","))
+	}
+}
+
+// Describes violations sharing the same path, category and key
+func describeKeyViolations(violations []Violation) string {
+	violation := violations[0]
+
+	switch violation.Category {
+	case CategoryDenied:
+		details := []string{}
+		if !violation.pattern.IsLiteral() {
+			details = append(details, fmt.Sprintf("denied by '%s'", violation.Pattern))
+		}
+		if violation.Reason != "" {
+			details = append(details, violation.Reason)
+		}
+		if len(details) == 0 {
+			return violation.Key
+		}
+		return fmt.Sprintf("%s (%s)", violation.Key, strings.Join(details, ", "))
+	case CategoryMandatory:
+		if violation.Reason != "" {
+			return fmt.Sprintf("%s (%s)", violation.Key, violation.Reason)
+		}
+		return violation.Key
+	case CategoryConstrained, CategoryMalformed:
+		failed := []failedConstraint{}
+		for _, v := range violations {
+			failed = append(failed, failedConstraint{
+				constrainedPattern: constrainedPattern{key: v.pattern},
+				reason:             v.Reason,
+			})
+		}
+		return describeFailedConstraints(violation.Key, failed)
+	case CategorySyntax, CategorySecret:
+		return fmt.Sprintf("%s (%s)", violation.Key, violation.Reason)
+	case CategoryLength:
+		return describeValueLengthViolations(violations)
+	case CategoryDependency:
+		reasons := []string{}
+		for _, v := range violations {
+			reasons = append(reasons, fmt.Sprintf("%s, required by '%s'", v.Reason, v.condition))
+		}
+		return fmt.Sprintf("%s (%s)", violation.Key, strings.Join(reasons, "; "))
+	case CategoryExclusive:
+		groups := []string{}
+		for _, v := range violations {
+			groups = append(groups, fmt.Sprintf("%s (%s)", v.Pattern, v.Reason))
+		}
+		return strings.Join(groups, ",")
+	case CategoryLimit:
+		limits := []string{}
+		for _, v := range violations {
+			limits = append(limits, describeMapLimitViolation(v))
+		}
+		return strings.Join(limits, ". ")
+	case CategoryImmutable:
+		value := "<removed>"
+		if violation.Value != nil {
+			value = fmt.Sprintf("'%s'", *violation.Value)
+		}
+		return fmt.Sprintf("%s (from '%s' to %s)", violation.Key, *violation.OldValue, value)
+	default:
+		return violation.Key
+	}
+}
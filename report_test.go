@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestReportIsSorted(t *testing.T) {
+	ownerPattern, _ := CompileKeyPattern("own*")
+
+	report := Report{}
+	report.add(
+		newViolation(CategoryMandatory, "metadata", "annotations", "team", literalKeyPattern("team")),
+		newViolation(CategoryMandatory, "metadata", "annotations", "cost-center", literalKeyPattern("cost-center")),
+		newViolation(CategoryDenied, "spec.template.metadata", "annotations", "foo", literalKeyPattern("foo")),
+		newViolation(CategoryDenied, "metadata", "annotations", "owner", ownerPattern),
+		newViolation(CategoryDenied, "metadata", "annotations", "bar", literalKeyPattern("bar")),
+	)
+
+	expectedMessage := "The following annotations are not allowed: bar,owner (denied by 'own*'). " +
+		"The following mandatory annotations are missing: cost-center,team. " +
+		"spec.template.metadata.annotations: The following annotations are not allowed: foo"
+	if message := report.Message(); message != expectedMessage {
+		t.Errorf("Unexpected message: %s", message)
+	}
+
+	reportJSON, err := report.JSON()
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	expectedJSON := `{"violations":[` +
+		`{"rule_id":"denied/bar","category":"denied","path":"metadata.annotations","key":"bar","pattern":"bar"},` +
+		`{"rule_id":"denied/own*","category":"denied","path":"metadata.annotations","key":"owner","pattern":"own*"},` +
+		`{"rule_id":"mandatory/cost-center","category":"mandatory","path":"metadata.annotations","key":"cost-center","pattern":"cost-center"},` +
+		`{"rule_id":"mandatory/team","category":"mandatory","path":"metadata.annotations","key":"team","pattern":"team"},` +
+		`{"rule_id":"denied/foo","category":"denied","path":"spec.template.metadata.annotations","key":"foo","pattern":"foo"}]}`
+	if string(reportJSON) != expectedJSON {
+		t.Errorf("Unexpected JSON report: %s", reportJSON)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"strings"
+)
+
+// The prefixes reserved to the Kubernetes project, their subdomains are
+// reserved too
+var reservedPrefixes = []string{"kubernetes.io", "k8s.io"}
+
+// The prefix reserved to Kubewarden, only when requested by the settings
+const kubewardenReservedPrefix = "kubewarden.io"
+
+// The keys that can be used under the reserved prefixes, shipped with
+// the policy
+//
+//go:embed data/reserved_keys.txt
+var builtinReservedKeysData string
+
+var builtinReservedKeys = mustParseKeyPatternList(builtinReservedKeysData)
+
+// Protects the reserved prefixes. The keys using them are rejected,
+// unless they are on the built-in allowlist or on the one of the
+// settings:
+//
+//	{
+//	   "kubewarden": true,
+//	   "allowed_keys": [ "kubernetes.io/my-key" ]
+//	}
+type ReservedPrefixes struct {
+	// Reserve the kubewarden.io prefix too
+	Kubewarden bool `json:"kubewarden"`
+	// The keys allowed on top of the built-in allowlist
+	AllowedKeys []*KeyPattern `json:"allowed_keys"`
+}
+
+func (r *ReservedPrefixes) UnmarshalJSON(data []byte) error {
+	rawReservedPrefixes := struct {
+		Kubewarden  bool     `json:"kubewarden"`
+		AllowedKeys []string `json:"allowed_keys"`
+	}{}
+
+	if err := json.Unmarshal(data, &rawReservedPrefixes); err != nil {
+		return err
+	}
+
+	allowedKeys, err := compileKeyPatterns(rawReservedPrefixes.AllowedKeys)
+	if err != nil {
+		return err
+	}
+
+	r.Kubewarden = rawReservedPrefixes.Kubewarden
+	r.AllowedKeys = allowedKeys
+	return nil
+}
+
+// Returns the reserved prefix used by the key, an empty string when the
+// key can be used
+func (r *ReservedPrefixes) violatedPrefix(key string) string {
+	prefix, _, prefixed := strings.Cut(key, "/")
+	if !prefixed {
+		return ""
+	}
+
+	reserved := reservedPrefixes
+	if r.Kubewarden {
+		reserved = append([]string{kubewardenReservedPrefix}, reservedPrefixes...)
+	}
+
+	for _, reservedPrefix := range reserved {
+		if prefix != reservedPrefix && !strings.HasSuffix(prefix, "."+reservedPrefix) {
+			continue
+		}
+		if matchingKeyPattern(builtinReservedKeys, key) != nil || matchingKeyPattern(r.AllowedKeys, key) != nil {
+			return ""
+		}
+		return reservedPrefix
+	}
+	return ""
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestReservedPrefixes(t *testing.T) {
+	reservedPrefixes := ReservedPrefixes{}
+	if err := json.Unmarshal([]byte(`{
+		"kubewarden": true,
+		"allowed_keys": [ "team.k8s.io/*" ]
+	}`), &reservedPrefixes); err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	cases := map[string]string{
+		"owner":                        "",
+		"example.com/owner":            "",
+		"notkubernetes.io/owner":       "",
+		"kubernetes.io/description":    "",
+		"app.kubernetes.io/name":       "",
+		"team.k8s.io/owner":            "",
+		"beta.kubernetes.io/os":        "",
+		"node.alpha.kubernetes.io/ttl": "",
+		"volumes.kubernetes.io/controller-managed-attach-detach": "",
+		"autoscaling.alpha.kubernetes.io/conditions":             "",
+		"nginx.ingress.kubernetes.io/rewrite-target":             "",
+		"alb.ingress.kubernetes.io/scheme":                       "",
+		"kubernetes.io/owner":                                    "kubernetes.io",
+		"example.kubernetes.io/owner":                            "kubernetes.io",
+		"k8s.io/owner":                                           "k8s.io",
+		"policies.kubewarden.io/owner":                           "kubewarden.io",
+	}
+
+	for key, expected := range cases {
+		if prefix := reservedPrefixes.violatedPrefix(key); prefix != expected {
+			t.Errorf("%s: expected '%s', got '%s'", key, expected, prefix)
+		}
+	}
+}
+
+func TestKubewardenPrefixIsNotReservedByDefault(t *testing.T) {
+	reservedPrefixes := ReservedPrefixes{}
+	if prefix := reservedPrefixes.violatedPrefix("kubewarden.io/owner"); prefix != "" {
+		t.Errorf("Unexpected reserved prefix '%s'", prefix)
+	}
+}
+
+func TestAcceptIngressControllerAnnotationsWithReservedPrefixes(t *testing.T) {
+	for _, fixture := range []string{"test_data/ingress-nginx.json", "test_data/ingress-snippets.json"} {
+		response := validateFixture(t, fixture, `{
+			"reserved_prefixes": {}
+		}`)
+		if !response.Accepted {
+			t.Errorf("%s: expected request to be accepted: %s", fixture, *response.Message)
+		}
+	}
+
+	// The snippets reach the checks of the profiles
+	response := validateFixture(t, "test_data/ingress-snippets.json", `{
+		"reserved_prefixes": {},
+		"profiles": ["ingress-nginx-restricted-snippets"]
+	}`)
+	expected := "The following annotations are violating user constraints: " +
+		"nginx.ingress.kubernetes.io/configuration-snippet " +
+		"(matched 'nginx.ingress.kubernetes.io/*-snippet': uses the forbidden directive 'alias')"
+	if response.Accepted || *response.Message != expected {
+		t.Errorf("Unexpected response: %+v", response)
+	}
+}
+
+func TestInvalidReservedKeys(t *testing.T) {
+	if _, err := parseKeyPatternList("# comment\n\nkubernetes.io/valid\nkubernetes.io/\\"); err == nil {
+		t.Error("Expected the trailing escape to be rejected")
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+
+	mapset "github.com/deckarep/golang-set/v2"
+	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
+)
+
+// A set of rules that is enforced only on the resources matched by
+// the group:
+//
+//	{
+//	   "match": {
+//	      "api_groups": ["apps", ""],
+//	      "kinds": ["Deployment", "Namespace"]
+//	   },
+//	   "mandatory_annotations": ["cost-center"]
+//	}
+type RuleGroup struct {
+	Match RuleMatch `json:"match"`
+	RuleSet
+}
+
+// Selects the resources a RuleGroup applies to. Each field is a list of
+// patterns, an empty list matches everything. A resource must satisfy
+// all the fields to be matched.
+type RuleMatch struct {
+	// Matched against `request.kind.group`, the core group is ""
+	APIGroups []*KeyPattern `json:"api_groups"`
+	// Matched against `request.kind.version`
+	APIVersions []*KeyPattern `json:"api_versions"`
+	// Matched against `request.kind.kind`
+	Kinds []*KeyPattern `json:"kinds"`
+	// Matched against `request.resource.resource`
+	Resources []*KeyPattern `json:"resources"`
+	// Matched against `request.namespace`, which is "" for cluster-scoped
+	// resources
+	Namespaces []*KeyPattern `json:"namespaces"`
+	// Resources whose namespace is matched by one of these patterns are
+	// never matched. An empty list excludes nothing
+	ExcludedNamespaces []*KeyPattern `json:"excluded_namespaces"`
+}
+
+// The attributes of the admission request used to select rule groups
+type requestScope struct {
+	Group     string
+	Version   string
+	Kind      string
+	Resource  string
+	Namespace string
+}
+
+func newRequestScope(request kubewarden_protocol.KubernetesAdmissionRequest, resource string) requestScope {
+	return requestScope{
+		Group:     request.Kind.Group,
+		Version:   request.Kind.Version,
+		Kind:      request.Kind.Kind,
+		Resource:  resource,
+		Namespace: request.Namespace,
+	}
+}
+
+func (m *RuleMatch) matches(scope requestScope) bool {
+	return matchesAny(m.APIGroups, scope.Group) &&
+		matchesAny(m.APIVersions, scope.Version) &&
+		matchesAny(m.Kinds, scope.Kind) &&
+		matchesAny(m.Resources, scope.Resource) &&
+		matchesAny(m.Namespaces, scope.Namespace) &&
+		matchingKeyPattern(m.ExcludedNamespaces, scope.Namespace) == nil
+}
+
+// An empty list of patterns matches every value
+func matchesAny(patterns []*KeyPattern, value string) bool {
+	return len(patterns) == 0 || matchingKeyPattern(patterns, value) != nil
+}
+
+// Reports whether some resources can be matched both by m and by other.
+// The excluded namespaces are not taken into account.
+func (m *RuleMatch) overlaps(other *RuleMatch) bool {
+	return patternsOverlap(m.APIGroups, other.APIGroups) &&
+		patternsOverlap(m.APIVersions, other.APIVersions) &&
+		patternsOverlap(m.Kinds, other.Kinds) &&
+		patternsOverlap(m.Resources, other.Resources) &&
+		patternsOverlap(m.Namespaces, other.Namespaces)
+}
+
+// Reports whether some value can be matched by both the lists of
+// patterns. Two patterns with wildcards are assumed to match a common
+// value.
+func patternsOverlap(patterns, others []*KeyPattern) bool {
+	if len(patterns) == 0 || len(others) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		value, literal := pattern.Literal()
+		for _, other := range others {
+			otherValue, otherLiteral := other.Literal()
+			switch {
+			case literal && other.Match(value):
+				return true
+			case otherLiteral && pattern.Match(otherValue):
+				return true
+			case !literal && !otherLiteral:
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (g *RuleGroup) UnmarshalJSON(data []byte) error {
+	// RuleSet implements json.Unmarshaler, which would otherwise be
+	// promoted to RuleGroup and ignore the match block
+	if err := json.Unmarshal(data, &g.RuleSet); err != nil {
+		return err
+	}
+
+	rawGroup := struct {
+		Match RuleMatch `json:"match"`
+	}{}
+
+	if err := json.Unmarshal(data, &rawGroup); err != nil {
+		return err
+	}
+
+	g.Match = rawGroup.Match
+
+	return nil
+}
+
+// Returns the rules to enforce on the request: the top-level ones,
+// merged with the ones of all the matching groups
+func (s *Settings) ruleSetFor(scope requestScope) RuleSet {
+	ruleSet := s.RuleSet
+	for _, group := range s.Rules {
+		if group.Match.matches(scope) {
+			ruleSet = ruleSet.merge(&group.RuleSet)
+		}
+	}
+	return ruleSet
+}
+
+// Returns the rules to enforce on the request, leaving out the ones in
+// monitor mode
+func (s *Settings) enforcedRuleSetFor(scope requestScope) RuleSet {
+	ruleSet := newRuleSet()
+	enforced := s.RuleSet.enforced()
+	ruleSet = ruleSet.merge(&enforced)
+	for _, group := range s.Rules {
+		if group.Match.matches(scope) {
+			enforced := group.RuleSet.enforced()
+			ruleSet = ruleSet.merge(&enforced)
+		}
+	}
+	return ruleSet
+}
+
+// Reports whether some of the rules to apply to the request are in
+// monitor mode
+func (s *Settings) monitors(scope requestScope) bool {
+	if s.RuleSet.hasMonitoredRules() {
+		return true
+	}
+	for _, group := range s.Rules {
+		if group.Match.matches(scope) && group.RuleSet.hasMonitoredRules() {
+			return true
+		}
+	}
+	return false
+}
+
+// Tells whether a rule in the given mode is only monitored. Rules without
+// a mode follow the one of the RuleSet.
+func (r *RuleSet) monitored(mode Mode) bool {
+	if mode == "" {
+		return r.Mode == ModeMonitor
+	}
+	return mode == ModeMonitor
+}
+
+// Reports whether the RuleSet, or some of its entries, are in monitor mode
+func (r *RuleSet) hasMonitoredRules() bool {
+	if r.Mode == ModeMonitor {
+		return true
+	}
+	for _, pattern := range r.deniedPatterns {
+		if pattern.mode == ModeMonitor {
+			return true
+		}
+	}
+	for _, pattern := range r.constrainedPatterns {
+		if pattern.mode == ModeMonitor {
+			return true
+		}
+	}
+	for _, mode := range r.mandatoryModes {
+		if mode == ModeMonitor {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the rules of the RuleSet that are enforced. The denied,
+// mandatory and constrained entries can override the mode of the RuleSet,
+// all the other rules follow it.
+func (r *RuleSet) enforced() RuleSet {
+	enforced := newRuleSet()
+	if r.Mode != ModeMonitor {
+		enforced = enforced.merge(r)
+		enforced.DeniedAnnotations = mapset.NewThreadUnsafeSet[string]()
+		enforced.MandatoryAnnotations = mapset.NewThreadUnsafeSet[string]()
+		enforced.ConstrainedAnnotations = map[string]*RegularExpression{}
+		enforced.deniedPatterns = nil
+		enforced.constrainedPatterns = nil
+	}
+	enforced.Action = r.Action
+	enforced.Mode = r.Mode
+
+	for _, pattern := range r.deniedPatterns {
+		if !r.monitored(pattern.mode) {
+			enforced.DeniedAnnotations.Add(pattern.String())
+			enforced.deniedPatterns = append(enforced.deniedPatterns, pattern)
+		}
+	}
+	for annotation := range r.MandatoryAnnotations.Iter() {
+		if r.monitored(r.mandatoryModes[annotation]) {
+			continue
+		}
+		enforced.MandatoryAnnotations.Add(annotation)
+		if value, found := r.mandatoryDefaults[annotation]; found {
+			enforced.mandatoryDefaults[annotation] = value
+		}
+		if message, found := r.mandatoryMessages[annotation]; found {
+			enforced.mandatoryMessages[annotation] = message
+		}
+	}
+	for _, pattern := range r.constrainedPatterns {
+		if !r.monitored(pattern.mode) {
+			enforced.ConstrainedAnnotations[pattern.key.String()] = pattern.value
+			enforced.constrainedPatterns = append(enforced.constrainedPatterns, pattern)
+		}
+	}
+
+	return enforced
+}
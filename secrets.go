@@ -0,0 +1,159 @@
+package main
+
+import (
+	"math"
+	"regexp"
+	"strings"
+)
+
+// Replaces the secrets found inside of the values, whenever they would
+// end up in a message or in a log
+const redactedSecret = "<redacted>"
+
+// Detects the secrets pasted into the annotation values. They would
+// otherwise show up in `kubectl describe` and in the audit logs. The
+// detection is enabled only when the settings define it:
+//
+//	{
+//	   "ignored_keys": [ "example.com/public-key" ],
+//	   "high_entropy": false
+//	}
+type SecretDetection struct {
+	// The keys whose values are not checked
+	IgnoredKeys []*KeyPattern `json:"ignored_keys"`
+	// Report the long random looking tokens, enabled by default
+	HighEntropy *bool `json:"high_entropy"`
+}
+
+// A detector of a well-known kind of secret
+type secretDetector struct {
+	// Identifies the detector inside of the rule IDs
+	name string
+	// Describes the kind of secret
+	description string
+	re          *regexp.Regexp
+}
+
+var secretDetectors = []secretDetector{
+	{"private_key", "private key", regexp.MustCompile(`(?s)-----BEGIN [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----.*?(-----END [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----|\z)`)},
+	{"aws_access_key", "AWS access key", regexp.MustCompile(`\b(AKIA|ASIA|ABIA|ACCA)[0-9A-Z]{16}\b`)},
+	{"github_token", "GitHub token", regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{"jwt", "JSON Web Token", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`)},
+}
+
+// The high entropy heuristic looks at the tokens made by the characters
+// of the base64 alphabets, at least this long
+var entropyTokenRegexp = regexp.MustCompile(`[A-Za-z0-9+/=_-]{20,}`)
+
+const (
+	highEntropyDetector    = "high_entropy"
+	highEntropyDescription = "high entropy string"
+	// Bits per character, random base64 strings are above it
+	highEntropyThreshold = 4.5
+)
+
+var hexadecimalRegexp = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+
+// The annotations that are never checked: they repeat the other
+// annotations of the object
+var builtinIgnoredSecretKeys = []*KeyPattern{
+	literalKeyPattern("kubectl.kubernetes.io/last-applied-configuration"),
+}
+
+// A secret found inside of a value
+type secretFinding struct {
+	detector    string
+	description string
+	// The value, and the text inside of it that looks like a secret
+	value, match string
+}
+
+// Returns the first secret found inside of the value, nil when the value
+// looks safe
+func (d *SecretDetection) detect(annotation, value string) *secretFinding {
+	if matchingKeyPattern(builtinIgnoredSecretKeys, annotation) != nil ||
+		matchingKeyPattern(d.IgnoredKeys, annotation) != nil {
+		return nil
+	}
+
+	for _, detector := range secretDetectors {
+		if match := detector.re.FindString(value); match != "" {
+			return &secretFinding{detector: detector.name, description: detector.description, value: value, match: match}
+		}
+	}
+
+	if d.HighEntropy != nil && !*d.HighEntropy {
+		return nil
+	}
+	for _, token := range entropyTokenRegexp.FindAllString(value, -1) {
+		if looksRandom(token) {
+			return &secretFinding{detector: highEntropyDetector, description: highEntropyDescription, value: value, match: token}
+		}
+	}
+
+	return nil
+}
+
+// Reports whether the token looks like a random secret. Hexadecimal
+// tokens are never reported, they are usually checksums and digests, like
+// the `checksum/config` annotations of Helm charts. The tokens must mix
+// letters and digits, to skip long words.
+func looksRandom(token string) bool {
+	if hexadecimalRegexp.MatchString(token) {
+		return false
+	}
+	if !strings.ContainsAny(token, "0123456789") ||
+		!strings.ContainsAny(strings.ToLower(token), "abcdefghijklmnopqrstuvwxyz") {
+		return false
+	}
+	return shannonEntropy(token) > highEntropyThreshold
+}
+
+// Returns the Shannon entropy of the string, in bits per character
+func shannonEntropy(text string) float64 {
+	counts := map[rune]int{}
+	length := 0
+	for _, c := range text {
+		counts[c]++
+		length++
+	}
+
+	entropy := 0.0
+	for _, count := range counts {
+		p := float64(count) / float64(length)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// Replaces the value, and the secret inside of it, with a placeholder.
+// The text is unchanged when there is no finding.
+func (f *secretFinding) redact(text string) string {
+	if f == nil {
+		return text
+	}
+	text = strings.ReplaceAll(text, f.value, redactedSecret)
+	return strings.ReplaceAll(text, f.match, redactedSecret)
+}
+
+// Removes the secrets from the messages, the reasons and the values of
+// the violations of the annotations, whatever their category. The
+// secrets found inside of the new values are given, the old values are
+// checked again.
+func (d *SecretDetection) redactViolations(violations []Violation, findings map[string]*secretFinding) {
+	for i := range violations {
+		v := &violations[i]
+		finding := findings[v.Key]
+
+		v.Message = finding.redact(v.Message)
+		v.Reason = finding.redact(v.Reason)
+		if v.Value != nil {
+			redacted := finding.redact(*v.Value)
+			v.Value = &redacted
+		}
+		if v.OldValue != nil {
+			redacted := d.detect(v.Key, *v.OldValue).redact(*v.OldValue)
+			v.OldValue = &redacted
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A semantic version, as defined by https://semver.org. Build metadata
+// is ignored, it does not affect the precedence of versions.
+type semanticVersion struct {
+	major, minor, patch uint64
+	preRelease          []string
+}
+
+// Parses a semantic version. A leading `v`, as in `v1.2.3`, is allowed.
+func parseSemanticVersion(version string) (semanticVersion, error) {
+	invalid := fmt.Errorf("'%s' is not a semantic version", version)
+
+	text := strings.TrimPrefix(version, "v")
+	text, _, _ = strings.Cut(text, "+")
+	text, preRelease, hasPreRelease := strings.Cut(text, "-")
+
+	parts := strings.Split(text, ".")
+	if len(parts) != 3 {
+		return semanticVersion{}, invalid
+	}
+
+	numbers := [3]uint64{}
+	for i, part := range parts {
+		if part == "" || (len(part) > 1 && part[0] == '0') {
+			return semanticVersion{}, invalid
+		}
+		number, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return semanticVersion{}, invalid
+		}
+		numbers[i] = number
+	}
+
+	parsed := semanticVersion{major: numbers[0], minor: numbers[1], patch: numbers[2]}
+	if hasPreRelease {
+		parsed.preRelease = strings.Split(preRelease, ".")
+		for _, identifier := range parsed.preRelease {
+			if identifier == "" {
+				return semanticVersion{}, invalid
+			}
+		}
+	}
+
+	return parsed, nil
+}
+
+func compareUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Returns -1, 0 or 1 when v precedes, equals or follows other
+func (v semanticVersion) compare(other semanticVersion) int {
+	if c := compareUint(v.major, other.major); c != 0 {
+		return c
+	}
+	if c := compareUint(v.minor, other.minor); c != 0 {
+		return c
+	}
+	if c := compareUint(v.patch, other.patch); c != 0 {
+		return c
+	}
+
+	// A version without pre-release identifiers follows the ones having
+	// them: 1.0.0-alpha < 1.0.0
+	switch {
+	case len(v.preRelease) == 0 && len(other.preRelease) == 0:
+		return 0
+	case len(v.preRelease) == 0:
+		return 1
+	case len(other.preRelease) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(v.preRelease) && i < len(other.preRelease); i++ {
+		a, b := v.preRelease[i], other.preRelease[i]
+		aNumber, aErr := strconv.ParseUint(a, 10, 64)
+		bNumber, bErr := strconv.ParseUint(b, 10, 64)
+
+		switch {
+		case aErr == nil && bErr == nil:
+			if c := compareUint(aNumber, bNumber); c != 0 {
+				return c
+			}
+		case aErr == nil:
+			// Numeric identifiers have lower precedence
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(a, b); c != 0 {
+				return c
+			}
+		}
+	}
+
+	return compareUint(uint64(len(v.preRelease)), uint64(len(other.preRelease)))
+}
+
+// A single comparison, like `>=1.2.0`
+type semverComparator struct {
+	operator string
+	version  semanticVersion
+}
+
+func (c semverComparator) matches(version semanticVersion) bool {
+	result := version.compare(c.version)
+	switch c.operator {
+	case "=":
+		return result == 0
+	case "!=":
+		return result != 0
+	case ">":
+		return result > 0
+	case ">=":
+		return result >= 0
+	case "<":
+		return result < 0
+	case "<=":
+		return result <= 0
+	}
+	return false
+}
+
+// A range of semantic versions, like `>=1.2.0 <2.0.0 || >=3.0.0`.
+// Comparators separated by spaces or commas must all be satisfied,
+// alternatives are separated by `||`.
+type semverRange struct {
+	raw          string
+	alternatives [][]semverComparator
+}
+
+func parseSemverRange(text string) (*semverRange, error) {
+	parsed := semverRange{raw: text}
+
+	for _, alternative := range strings.Split(text, "||") {
+		fields := strings.FieldsFunc(alternative, func(r rune) bool {
+			return r == ' ' || r == ','
+		})
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("invalid semantic version range '%s': empty alternative", text)
+		}
+
+		comparators := []semverComparator{}
+		for _, field := range fields {
+			operator := "="
+			for _, op := range []string{">=", "<=", "!=", ">", "<", "="} {
+				if strings.HasPrefix(field, op) {
+					operator = op
+					break
+				}
+			}
+
+			version, err := parseSemanticVersion(strings.TrimPrefix(field, operator))
+			if err != nil {
+				return nil, fmt.Errorf("invalid semantic version range '%s': %w", text, err)
+			}
+			comparators = append(comparators, semverComparator{operator: operator, version: version})
+		}
+		parsed.alternatives = append(parsed.alternatives, comparators)
+	}
+
+	return &parsed, nil
+}
+
+func (r *semverRange) matches(version semanticVersion) bool {
+	for _, comparators := range r.alternatives {
+		matched := true
+		for _, comparator := range comparators {
+			if !comparator.matches(version) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
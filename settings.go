@@ -4,9 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 
 	mapset "github.com/deckarep/golang-set/v2"
+	"github.com/kubewarden/gjson"
 	kubewarden "github.com/kubewarden/policy-sdk-go"
 	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
 )
@@ -47,10 +49,112 @@ func (r *RegularExpression) MarshalText() ([]byte, error) {
 	return nil, nil
 }
 
-type Settings struct {
+// What to do with the denied annotations found on a resource
+type Action string
+
+const (
+	// Reject the resource
+	ActionReject Action = "reject"
+	// Remove the annotation and accept the resource
+	ActionStrip Action = "strip"
+)
+
+// UnmarshalText satisfies the encoding.TextMarshaler interface,
+// also used by json.Unmarshal.
+func (a *Action) UnmarshalText(text []byte) error {
+	switch action := Action(text); action {
+	case ActionReject, ActionStrip:
+		*a = action
+		return nil
+	default:
+		return fmt.Errorf("unknown action '%s', must be either '%s' or '%s'", action, ActionReject, ActionStrip)
+	}
+}
+
+// Whether the violations of the rules reject the resource
+type Mode string
+
+const (
+	// Reject the resources violating the rules
+	ModeEnforce Mode = "enforce"
+	// Accept the resources violating the rules, reporting the violations
+	ModeMonitor Mode = "monitor"
+)
+
+// UnmarshalText satisfies the encoding.TextMarshaler interface,
+// also used by json.Unmarshal.
+func (m *Mode) UnmarshalText(text []byte) error {
+	switch mode := Mode(text); mode {
+	case ModeEnforce, ModeMonitor:
+		*m = mode
+		return nil
+	default:
+		return fmt.Errorf("unknown mode '%s', must be either '%s' or '%s'", mode, ModeEnforce, ModeMonitor)
+	}
+}
+
+// The annotation rules enforced by the policy. The rules can be
+// defined at the top level of the settings, or inside of a rule group.
+type RuleSet struct {
 	DeniedAnnotations      mapset.Set[string]            `json:"denied_annotations"`
 	MandatoryAnnotations   mapset.Set[string]            `json:"mandatory_annotations"`
 	ConstrainedAnnotations map[string]*RegularExpression `json:"constrained_annotations"`
+	ImmutableAnnotations   mapset.Set[string]            `json:"immutable_annotations"`
+	// What to do with the denied annotations. When empty, the action of
+	// the top-level rules is used, which defaults to reject
+	Action Action `json:"action,omitempty"`
+	// Whether the violations reject the resource. When empty, the mode of
+	// the top-level rules is used, which defaults to enforce
+	Mode Mode `json:"mode,omitempty"`
+	// The maximum length of the values, in bytes, by annotation pattern
+	MaxValueLengths map[string]int `json:"max_value_lengths"`
+	// The maximum number of annotations, and their maximum total size in
+	// bytes, keys included. Zero means no limit
+	MaxAnnotations      int `json:"max_annotations,omitempty"`
+	MaxAnnotationsBytes int `json:"max_annotations_bytes,omitempty"`
+	// The syntax of the keys is checked only when defined
+	KeySyntax *KeySyntax `json:"key_syntax,omitempty"`
+	// The reserved prefixes are protected only when defined
+	ReservedPrefixes *ReservedPrefixes `json:"reserved_prefixes,omitempty"`
+	// Annotations that become mandatory, or constrained, when another
+	// annotation is present
+	Dependencies []Dependency `json:"dependencies,omitempty"`
+	// Groups of annotations that cannot be present together
+	ExclusiveAnnotations []ExclusiveGroup `json:"exclusive_annotations,omitempty"`
+	// Built-in sets of rules added to the ones above
+	Profiles []Profile `json:"profiles,omitempty"`
+	// The values are checked for secrets only when defined
+	SecretDetection *SecretDetection `json:"secret_detection,omitempty"`
+
+	deniedPatterns      []deniedEntry
+	constrainedPatterns []constrainedPattern
+	immutablePatterns   []*KeyPattern
+	valueLengthLimits   []valueLengthLimit
+	// Values added to the resources missing a mandatory annotation
+	mandatoryDefaults map[string]string
+	// Custom messages of the mandatory annotations
+	mandatoryMessages map[string]*ruleMessage
+	// Modes of the mandatory annotations overriding the one of the RuleSet
+	mandatoryModes map[string]Mode
+}
+
+type Settings struct {
+	// The rules applied to every resource
+	RuleSet
+
+	// The rules applied only to the resources matched by the group
+	Rules []RuleGroup `json:"rules"`
+
+	// The parts of the object whose metadata is validated, by default
+	// only the object itself
+	Locations []Location `json:"locations"`
+
+	// The metadata maps validated by the rules, by default only the
+	// annotations
+	Target Target `json:"target,omitempty"`
+
+	// The users for which some rules are skipped
+	Exemptions []Exemption `json:"exemptions"`
 }
 
 // Builds a new Settings instance starting from a validation
@@ -61,7 +165,23 @@ type Settings struct {
 //	   "settings": {
 //	      "denied_annotations": [...],
 //	      "mandatory_annotations": [...],
-//	      "constrained_annotations": { ... }
+//	      "constrained_annotations": { ... },
+//	      "immutable_annotations": [...],
+//	      "max_value_lengths": { ... },
+//	      "max_annotations": 64,
+//	      "max_annotations_bytes": 65536,
+//	      "key_syntax": { ... },
+//	      "reserved_prefixes": { ... },
+//	      "dependencies": [...],
+//	      "exclusive_annotations": [...],
+//	      "profiles": [...],
+//	      "secret_detection": { ... },
+//	      "action": "reject",
+//	      "mode": "enforce",
+//	      "rules": [...],
+//	      "locations": [...],
+//	      "target": "annotations",
+//	      "exemptions": [...]
 //	   }
 //	}
 func NewSettingsFromValidationReq(validationRequest kubewarden_protocol.ValidationRequest) (Settings, error) {
@@ -76,61 +196,550 @@ func NewSettingsFromValidationReq(validationRequest kubewarden_protocol.Validati
 }
 
 func (s *Settings) Valid() (bool, error) {
+	globalConflicts := s.RuleSet.conflicts()
+	errors := globalConflicts.errors()
+
+	// The top-level rules are applied together with the ones of each
+	// group, hence they must not conflict either
+	groupConflicts := make([]ruleConflicts, len(s.Rules))
+	for i, group := range s.Rules {
+		merged := s.RuleSet.merge(&group.RuleSet)
+		groupConflicts[i] = merged.conflicts()
+		for _, err := range groupConflicts[i].without(globalConflicts).errors() {
+			errors = append(errors, fmt.Sprintf("rules[%d]: %s", i, err))
+		}
+	}
+
+	// So are the groups that can match the same resources
+	for i := range s.Rules {
+		for j := i + 1; j < len(s.Rules); j++ {
+			if !s.Rules[i].Match.overlaps(&s.Rules[j].Match) {
+				continue
+			}
+			merged := s.RuleSet.merge(&s.Rules[i].RuleSet)
+			merged = merged.merge(&s.Rules[j].RuleSet)
+			conflicts := merged.conflicts().without(groupConflicts[i]).without(groupConflicts[j])
+			for _, err := range conflicts.errors() {
+				errors = append(errors, fmt.Sprintf("rules[%d] and rules[%d]: %s", i, j, err))
+			}
+		}
+	}
+
+	errors = append(errors, s.exemptionErrors()...)
+
+	if len(errors) > 0 {
+		return false, fmt.Errorf("%s", strings.Join(errors, "; "))
+	}
+	return true, nil
+}
+
+// The annotations that are denied and, at the same time, either
+// constrained or mandatory
+type ruleConflicts struct {
+	constrained []string
+	mandatory   []string
+	// Default values of mandatory annotations violating the constraints
+	defaults []string
+	// Dependencies requiring themselves
+	cycles []string
+	// Exclusive groups that cannot be satisfied
+	exclusive []string
+}
+
+func (r *RuleSet) conflicts() ruleConflicts {
+	// Only the constraints matching a single key can be checked against
+	// the deny list, patterns could match keys that are not denied
 	constrainedAnnotations := mapset.NewThreadUnsafeSet[string]()
 
-	for annotations := range s.ConstrainedAnnotations {
-		constrainedAnnotations.Add(annotations)
+	for _, constraint := range r.constrainedPatterns {
+		if annotation, literal := constraint.key.Literal(); literal {
+			constrainedAnnotations.Add(annotation)
+		}
 	}
 
+	return ruleConflicts{
+		constrained: r.deniedOverlaps(constrainedAnnotations),
+		mandatory:   r.deniedOverlaps(r.MandatoryAnnotations),
+		defaults:    r.invalidDefaults(),
+		cycles:      r.dependencyCycles(),
+		exclusive:   r.impossibleExclusiveGroups(),
+	}
+}
+
+// Returns the default values that would not be accepted by the
+// constraints of their annotation
+func (r *RuleSet) invalidDefaults() []string {
+	invalid := []string{}
+	for _, annotation := range mapset.Sorted(r.MandatoryAnnotations) {
+		value, found := r.mandatoryDefaults[annotation]
+		if !found {
+			continue
+		}
+		failed := r.failedConstraints(annotation, value, gjson.Result{})
+		if len(failed) == 0 {
+			continue
+		}
+		invalid = append(invalid, describeFailedConstraints(annotation, failed))
+	}
+	return invalid
+}
+
+// Returns the conflicts that are not reported by other
+func (c ruleConflicts) without(other ruleConflicts) ruleConflicts {
+	return ruleConflicts{
+		constrained: mapset.Sorted(mapset.NewThreadUnsafeSet(c.constrained...).
+			Difference(mapset.NewThreadUnsafeSet(other.constrained...))),
+		mandatory: mapset.Sorted(mapset.NewThreadUnsafeSet(c.mandatory...).
+			Difference(mapset.NewThreadUnsafeSet(other.mandatory...))),
+		defaults: mapset.Sorted(mapset.NewThreadUnsafeSet(c.defaults...).
+			Difference(mapset.NewThreadUnsafeSet(other.defaults...))),
+		cycles: mapset.Sorted(mapset.NewThreadUnsafeSet(c.cycles...).
+			Difference(mapset.NewThreadUnsafeSet(other.cycles...))),
+		exclusive: mapset.Sorted(mapset.NewThreadUnsafeSet(c.exclusive...).
+			Difference(mapset.NewThreadUnsafeSet(other.exclusive...))),
+	}
+}
+
+func (c ruleConflicts) errors() []string {
 	errors := []string{}
 
-	constrainedAndDenied := constrainedAnnotations.Intersect(s.DeniedAnnotations)
-	if constrainedAndDenied.Cardinality() != 0 {
-		violations := constrainedAndDenied.ToSlice()
+	if len(c.constrained) != 0 {
 		errors = append(
 			errors,
 			fmt.Sprintf(
 				"These annotations cannot be constrained and denied at the same time: %s",
-				strings.Join(violations, ","),
+				strings.Join(c.constrained, ","),
 			),
 		)
 	}
 
-	mandatoryAndDenied := s.MandatoryAnnotations.Intersect(s.DeniedAnnotations)
-	if mandatoryAndDenied.Cardinality() != 0 {
-		violations := mandatoryAndDenied.ToSlice()
+	if len(c.mandatory) != 0 {
 		errors = append(
 			errors,
 			fmt.Sprintf(
 				"These annotations cannot be mandatory and denied at the same time: %s",
-				strings.Join(violations, ","),
+				strings.Join(c.mandatory, ","),
 			),
 		)
 	}
 
-	if len(errors) > 0 {
-		return false, fmt.Errorf("%s", strings.Join(errors, "; "))
+	if len(c.defaults) != 0 {
+		errors = append(
+			errors,
+			fmt.Sprintf(
+				"The default values of these annotations are violating user constraints: %s",
+				strings.Join(c.defaults, ","),
+			),
+		)
 	}
-	return true, nil
+
+	if len(c.cycles) != 0 {
+		errors = append(
+			errors,
+			fmt.Sprintf(
+				"These dependencies are requiring themselves: %s",
+				strings.Join(c.cycles, ","),
+			),
+		)
+	}
+
+	if len(c.exclusive) != 0 {
+		errors = append(
+			errors,
+			fmt.Sprintf(
+				"These exclusive annotations cannot be satisfied: %s",
+				strings.Join(c.exclusive, ","),
+			),
+		)
+	}
+
+	return errors
 }
 
-func (s *Settings) UnmarshalJSON(data []byte) error {
+// Returns the annotations that are also covered by the deny list.
+// Annotations denied through a glob pattern are followed by the pattern.
+func (r *RuleSet) deniedOverlaps(annotations mapset.Set[string]) []string {
+	overlaps := []string{}
+	for _, annotation := range mapset.Sorted(annotations) {
+		pattern := r.deniedPattern(annotation)
+		if pattern == nil {
+			continue
+		}
+		if pattern.IsLiteral() {
+			overlaps = append(overlaps, annotation)
+		} else {
+			overlaps = append(overlaps, fmt.Sprintf("%s (denied by '%s')", annotation, pattern))
+		}
+	}
+	return overlaps
+}
+
+// Returns the deny list entry matching the annotation, nil when the
+// annotation is not denied. Entries rejecting the annotation take
+// precedence over the ones stripping it.
+func (r *RuleSet) deniedPattern(annotation string) *deniedEntry {
+	var found *deniedEntry
+	for i := range r.deniedPatterns {
+		entry := &r.deniedPatterns[i]
+		if !entry.Match(annotation) {
+			continue
+		}
+		if entry.action != ActionStrip {
+			return entry
+		}
+		if found == nil {
+			found = entry
+		}
+	}
+	return found
+}
+
+// Returns all the constraints whose key pattern matches the annotation
+func (r *RuleSet) constraintsFor(annotation string) []constrainedPattern {
+	constraints := []constrainedPattern{}
+	for _, constraint := range r.constrainedPatterns {
+		if constraint.key.Match(annotation) {
+			constraints = append(constraints, constraint)
+		}
+	}
+	return constraints
+}
+
+// Applies all the constraints matching the annotation to its value.
+// Returns the constraints that are not satisfied. The object is needed by
+// the references to other fields.
+func (r *RuleSet) failedConstraints(annotation, value string, object gjson.Result) []failedConstraint {
+	failed := []failedConstraint{}
+	for _, constraint := range r.constraintsFor(annotation) {
+		if isFailed, reason := constraint.failure(value, object); isFailed {
+			malformed := reason != "" && constraint.malformed(value)
+			failed = append(failed, failedConstraint{constraint, reason, malformed})
+		}
+	}
+	return failed
+}
+
+// Describes an annotation that does not satisfy some constraints. The
+// description includes the patterns that matched the annotation, unless
+// it was matched only by its name, and the reasons given by the typed
+// constraints.
+func describeFailedConstraints(annotation string, failed []failedConstraint) string {
+	reportPatterns := false
+	for _, constraint := range failed {
+		reportPatterns = reportPatterns || !constraint.key.IsLiteral()
+	}
+
+	details := []string{}
+	for _, constraint := range failed {
+		detail := []string{}
+		if reportPatterns {
+			detail = append(detail, fmt.Sprintf("'%s'", constraint.key))
+		}
+		if constraint.reason != "" {
+			detail = append(detail, constraint.reason)
+		}
+		if len(detail) > 0 {
+			details = append(details, strings.Join(detail, ": "))
+		}
+	}
+
+	switch {
+	case len(details) == 0:
+		return annotation
+	case reportPatterns:
+		return fmt.Sprintf("%s (matched %s)", annotation, strings.Join(details, ", "))
+	default:
+		return fmt.Sprintf("%s (%s)", annotation, strings.Join(details, ", "))
+	}
+}
+
+// Returns the immutable_annotations entry matching the annotation, nil
+// when the annotation can be changed
+func (r *RuleSet) immutablePattern(annotation string) *KeyPattern {
+	return matchingKeyPattern(r.immutablePatterns, annotation)
+}
+
+// Sets the action of the RuleSet, unless it has been defined by the user.
+// The entries defining their own action keep it.
+func (r *RuleSet) defaultAction(action Action) {
+	if r.Action != "" {
+		return
+	}
+	r.Action = action
+	for i := range r.deniedPatterns {
+		if r.deniedPatterns[i].action == "" {
+			r.deniedPatterns[i].action = action
+		}
+	}
+}
+
+// Sets the mode of the RuleSet, unless it has been defined by the user
+func (r *RuleSet) defaultMode(mode Mode) {
+	if r.Mode == "" {
+		r.Mode = mode
+	}
+}
+
+// Returns a new RuleSet without rules
+func newRuleSet() RuleSet {
+	return RuleSet{
+		DeniedAnnotations:      mapset.NewThreadUnsafeSet[string](),
+		MandatoryAnnotations:   mapset.NewThreadUnsafeSet[string](),
+		ConstrainedAnnotations: map[string]*RegularExpression{},
+		ImmutableAnnotations:   mapset.NewThreadUnsafeSet[string](),
+		MaxValueLengths:        map[string]int{},
+		mandatoryDefaults:      map[string]string{},
+		mandatoryMessages:      map[string]*ruleMessage{},
+		mandatoryModes:         map[string]Mode{},
+	}
+}
+
+// Returns a new RuleSet enforcing both the rules of r and the ones of other
+func (r *RuleSet) merge(other *RuleSet) RuleSet {
+	merged := RuleSet{
+		DeniedAnnotations:      r.DeniedAnnotations.Union(other.DeniedAnnotations),
+		MandatoryAnnotations:   r.MandatoryAnnotations.Union(other.MandatoryAnnotations),
+		ConstrainedAnnotations: map[string]*RegularExpression{},
+		ImmutableAnnotations:   r.ImmutableAnnotations.Union(other.ImmutableAnnotations),
+		Action:                 r.Action,
+		Mode:                   r.Mode,
+		MaxValueLengths:        map[string]int{},
+		MaxAnnotations:         r.MaxAnnotations,
+		MaxAnnotationsBytes:    r.MaxAnnotationsBytes,
+		KeySyntax:              r.KeySyntax,
+		ReservedPrefixes:       r.ReservedPrefixes,
+		SecretDetection:        r.SecretDetection,
+		mandatoryDefaults:      map[string]string{},
+		mandatoryMessages:      map[string]*ruleMessage{},
+		mandatoryModes:         map[string]Mode{},
+	}
+
+	// The defaults of other take precedence, they are more specific
+	for key, value := range r.mandatoryDefaults {
+		merged.mandatoryDefaults[key] = value
+	}
+	for key, value := range other.mandatoryDefaults {
+		merged.mandatoryDefaults[key] = value
+	}
+	for key, value := range r.mandatoryMessages {
+		merged.mandatoryMessages[key] = value
+	}
+	for key, value := range other.mandatoryMessages {
+		merged.mandatoryMessages[key] = value
+	}
+	for key, value := range r.mandatoryModes {
+		merged.mandatoryModes[key] = value
+	}
+	for key, value := range other.mandatoryModes {
+		merged.mandatoryModes[key] = value
+	}
+
+	// The same key can be constrained twice, in that case both the
+	// regular expressions are kept inside of constrainedPatterns
+	for key, value := range r.ConstrainedAnnotations {
+		merged.ConstrainedAnnotations[key] = value
+	}
+	for key, value := range other.ConstrainedAnnotations {
+		merged.ConstrainedAnnotations[key] = value
+	}
+
+	merged.deniedPatterns = append(merged.deniedPatterns, r.deniedPatterns...)
+	merged.deniedPatterns = append(merged.deniedPatterns, other.deniedPatterns...)
+	merged.constrainedPatterns = append(merged.constrainedPatterns, r.constrainedPatterns...)
+	merged.constrainedPatterns = append(merged.constrainedPatterns, other.constrainedPatterns...)
+	merged.immutablePatterns = append(merged.immutablePatterns, r.immutablePatterns...)
+	merged.immutablePatterns = append(merged.immutablePatterns, other.immutablePatterns...)
+
+	// All the value length limits apply, the map limits of other take
+	// precedence
+	for key, value := range r.MaxValueLengths {
+		merged.MaxValueLengths[key] = value
+	}
+	for key, value := range other.MaxValueLengths {
+		merged.MaxValueLengths[key] = value
+	}
+	merged.valueLengthLimits = append(merged.valueLengthLimits, r.valueLengthLimits...)
+	merged.valueLengthLimits = append(merged.valueLengthLimits, other.valueLengthLimits...)
+	if other.MaxAnnotations != 0 {
+		merged.MaxAnnotations = other.MaxAnnotations
+	}
+	if other.MaxAnnotationsBytes != 0 {
+		merged.MaxAnnotationsBytes = other.MaxAnnotationsBytes
+	}
+	if other.KeySyntax != nil {
+		merged.KeySyntax = other.KeySyntax
+	}
+	if other.ReservedPrefixes != nil {
+		merged.ReservedPrefixes = other.ReservedPrefixes
+	}
+	if other.SecretDetection != nil {
+		merged.SecretDetection = other.SecretDetection
+	}
+
+	merged.Dependencies = append(merged.Dependencies, r.Dependencies...)
+	merged.Dependencies = append(merged.Dependencies, other.Dependencies...)
+	merged.ExclusiveAnnotations = append(merged.ExclusiveAnnotations, r.ExclusiveAnnotations...)
+	merged.ExclusiveAnnotations = append(merged.ExclusiveAnnotations, other.ExclusiveAnnotations...)
+	// The rules of the profiles are already part of the patterns
+	merged.Profiles = append(merged.Profiles, r.Profiles...)
+	merged.Profiles = append(merged.Profiles, other.Profiles...)
+
+	return merged
+}
+
+func (r *RuleSet) UnmarshalJSON(data []byte) error {
 	// This is needed becaus golang-set v2.3.0 has a bug that prevents
 	// the correct unmarshalling of ThreadUnsafeSet types.
-	rawSettings := struct {
-		DeniedAnnotations      []string                      `json:"denied_annotations"`
-		MandatoryAnnotations   []string                      `json:"mandatory_annotations"`
-		ConstrainedAnnotations map[string]*RegularExpression `json:"constrained_annotations"`
+	rawRuleSet := struct {
+		DeniedAnnotations      []deniedRawEntry           `json:"denied_annotations"`
+		MandatoryAnnotations   []mandatoryEntry           `json:"mandatory_annotations"`
+		ConstrainedAnnotations map[string]constraintEntry `json:"constrained_annotations"`
+		ImmutableAnnotations   []string                   `json:"immutable_annotations"`
+		Action                 Action                     `json:"action"`
+		Mode                   Mode                       `json:"mode"`
+		MaxValueLengths        map[string]int             `json:"max_value_lengths"`
+		MaxAnnotations         int                        `json:"max_annotations"`
+		MaxAnnotationsBytes    int                        `json:"max_annotations_bytes"`
+		KeySyntax              *KeySyntax                 `json:"key_syntax"`
+		ReservedPrefixes       *ReservedPrefixes          `json:"reserved_prefixes"`
+		Dependencies           []Dependency               `json:"dependencies"`
+		ExclusiveAnnotations   []ExclusiveGroup           `json:"exclusive_annotations"`
+		Profiles               []Profile                  `json:"profiles"`
+		SecretDetection        *SecretDetection           `json:"secret_detection"`
 	}{}
 
-	err := json.Unmarshal(data, &rawSettings)
+	err := json.Unmarshal(data, &rawRuleSet)
+	if err != nil {
+		return err
+	}
+
+	r.Action = rawRuleSet.Action
+	r.Mode = rawRuleSet.Mode
+	r.DeniedAnnotations = mapset.NewThreadUnsafeSet[string]()
+	r.deniedPatterns = make([]deniedEntry, 0, len(rawRuleSet.DeniedAnnotations))
+	for _, entry := range rawRuleSet.DeniedAnnotations {
+		pattern, err := CompileKeyPattern(entry.Key)
+		if err != nil {
+			return err
+		}
+		action := entry.Action
+		if action == "" {
+			action = r.Action
+		}
+		r.DeniedAnnotations.Add(entry.Key)
+		r.deniedPatterns = append(r.deniedPatterns, deniedEntry{
+			KeyPattern: pattern,
+			action:     action,
+			message:    entry.ruleMessage,
+			mode:       entry.Mode,
+		})
+	}
+
+	r.MandatoryAnnotations = mapset.NewThreadUnsafeSet[string]()
+	r.mandatoryDefaults = map[string]string{}
+	r.mandatoryMessages = map[string]*ruleMessage{}
+	r.mandatoryModes = map[string]Mode{}
+	for _, entry := range rawRuleSet.MandatoryAnnotations {
+		r.MandatoryAnnotations.Add(entry.Key)
+		if entry.Default != nil {
+			r.mandatoryDefaults[entry.Key] = *entry.Default
+		}
+		if entry.ruleMessage != nil {
+			r.mandatoryMessages[entry.Key] = entry.ruleMessage
+		}
+		if entry.Mode != "" {
+			r.mandatoryModes[entry.Key] = entry.Mode
+		}
+	}
+
+	immutablePatterns, err := compileKeyPatterns(rawRuleSet.ImmutableAnnotations)
+	if err != nil {
+		return err
+	}
+
+	r.ImmutableAnnotations = mapset.NewThreadUnsafeSet[string](rawRuleSet.ImmutableAnnotations...)
+	r.immutablePatterns = immutablePatterns
+
+	constrainedKeys := make([]string, 0, len(rawRuleSet.ConstrainedAnnotations))
+	for key := range rawRuleSet.ConstrainedAnnotations {
+		constrainedKeys = append(constrainedKeys, key)
+	}
+	sort.Strings(constrainedKeys)
+
+	r.ConstrainedAnnotations = map[string]*RegularExpression{}
+	r.constrainedPatterns = make([]constrainedPattern, 0, len(constrainedKeys))
+	for _, key := range constrainedKeys {
+		pattern, err := CompileKeyPattern(key)
+		if err != nil {
+			return err
+		}
+		entry := rawRuleSet.ConstrainedAnnotations[key]
+		r.ConstrainedAnnotations[key] = entry.Regex
+		r.constrainedPatterns = append(r.constrainedPatterns, constrainedPattern{
+			key:       pattern,
+			value:     entry.Regex,
+			check:     entry.check,
+			reference: entry.reference,
+			list:      entry.list,
+			message:   entry.ruleMessage,
+			mode:      entry.mode,
+		})
+	}
+
+	valueLengthLimits, err := compileValueLengthLimits(rawRuleSet.MaxValueLengths)
 	if err != nil {
 		return err
 	}
+	if rawRuleSet.MaxAnnotations < 0 || rawRuleSet.MaxAnnotationsBytes < 0 {
+		return fmt.Errorf("max_annotations and max_annotations_bytes cannot be negative")
+	}
+
+	r.MaxValueLengths = map[string]int{}
+	for key, value := range rawRuleSet.MaxValueLengths {
+		r.MaxValueLengths[key] = value
+	}
+	r.valueLengthLimits = valueLengthLimits
+	r.MaxAnnotations = rawRuleSet.MaxAnnotations
+	r.MaxAnnotationsBytes = rawRuleSet.MaxAnnotationsBytes
+	r.KeySyntax = rawRuleSet.KeySyntax
+	r.ReservedPrefixes = rawRuleSet.ReservedPrefixes
+	r.Dependencies = rawRuleSet.Dependencies
+	r.ExclusiveAnnotations = rawRuleSet.ExclusiveAnnotations
+	r.Profiles = rawRuleSet.Profiles
+	r.SecretDetection = rawRuleSet.SecretDetection
+
+	return r.applyProfiles()
+}
+
+func (s *Settings) UnmarshalJSON(data []byte) error {
+	// RuleSet implements json.Unmarshaler, which would otherwise be
+	// promoted to Settings and ignore the other fields
+	if err := json.Unmarshal(data, &s.RuleSet); err != nil {
+		return err
+	}
+
+	rawSettings := struct {
+		Rules      []RuleGroup `json:"rules"`
+		Locations  []Location  `json:"locations"`
+		Target     Target      `json:"target"`
+		Exemptions []Exemption `json:"exemptions"`
+	}{}
+
+	if err := json.Unmarshal(data, &rawSettings); err != nil {
+		return err
+	}
 
-	s.DeniedAnnotations = mapset.NewThreadUnsafeSet[string](rawSettings.DeniedAnnotations...)
-	s.MandatoryAnnotations = mapset.NewThreadUnsafeSet[string](rawSettings.MandatoryAnnotations...)
-	s.ConstrainedAnnotations = rawSettings.ConstrainedAnnotations
+	s.Rules = rawSettings.Rules
+	s.Locations = rawSettings.Locations
+	s.Target = rawSettings.Target
+	s.Exemptions = rawSettings.Exemptions
+
+	s.RuleSet.defaultAction(ActionReject)
+	s.RuleSet.defaultMode(ModeEnforce)
+	for i := range s.Rules {
+		s.Rules[i].defaultAction(s.Action)
+		s.Rules[i].defaultMode(s.Mode)
+	}
 
 	return nil
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"strings"
 	"testing"
 
 	"encoding/json"
@@ -181,3 +182,724 @@ func TestDetectNotValidSettingsDueToConflictingDeniedAndMandatoryAnnotations(t *
 		t.Errorf("Unexpected validation error message: %s", *response.Message)
 	}
 }
+
+func TestParseSettingsWithInvalidDeniedPattern(t *testing.T) {
+	settingsJSON := []byte(`
+	{
+		"denied_annotations": [ "foo\\" ]
+	}`)
+
+	err := json.Unmarshal(settingsJSON, &Settings{})
+	if err == nil {
+		t.Errorf("Didn't get expected error")
+	}
+}
+
+func TestDeniedPatternMatching(t *testing.T) {
+	settingsJSON := []byte(`
+	{
+		"denied_annotations": [
+			"nginx.ingress.kubernetes.io/*-snippet",
+			"*.internal.corp/*",
+			"literal.example.com/\\*",
+			"team-?"
+		]
+	}`)
+
+	settings := Settings{}
+	if err := json.Unmarshal(settingsJSON, &settings); err != nil {
+		t.Fatalf("Unexpected error %+v", err)
+	}
+
+	cases := map[string]bool{
+		"nginx.ingress.kubernetes.io/server-snippet":        true,
+		"nginx.ingress.kubernetes.io/configuration-snippet": true,
+		"nginx.ingress.kubernetes.io/rewrite-target":        false,
+		"billing.internal.corp/owner":                       true,
+		"internal.corp/owner":                               false,
+		"literal.example.com/*":                             true,
+		"literal.example.com/foo":                           false,
+		"team-a":                                            true,
+		"team-ab":                                           false,
+	}
+
+	for annotation, denied := range cases {
+		if (settings.deniedPattern(annotation) != nil) != denied {
+			t.Errorf("Expected annotation %s to be denied: %v", annotation, denied)
+		}
+	}
+}
+
+func TestDetectNotValidSettingsDueToDeniedPatternCoveringMandatoryAnnotation(t *testing.T) {
+	request := `
+	{
+		"denied_annotations": [ "*.internal.corp/*" ],
+		"mandatory_annotations": ["billing.internal.corp/owner"],
+		"constrained_annotations": {
+			"cost-center": ".*"
+		}
+	}
+	`
+	rawRequest := []byte(request)
+	responsePayload, err := validateSettings(rawRequest)
+	if err != nil {
+		t.Errorf("Unexpected error %+v", err)
+	}
+
+	var response kubewarden_protocol.SettingsValidationResponse
+	if err := json.Unmarshal(responsePayload, &response); err != nil {
+		t.Errorf("Unexpected error: %+v", err)
+	}
+
+	if response.Valid {
+		t.Error("Expected settings to not be valid")
+	}
+
+	if *response.Message != "Provided settings are not valid: These annotations cannot be mandatory and denied at the same time: billing.internal.corp/owner (denied by '*.internal.corp/*')" {
+		t.Errorf("Unexpected validation error message: %s", *response.Message)
+	}
+}
+
+func TestDetectNotValidSettingsDueToDeniedPatternCoveringConstrainedAnnotation(t *testing.T) {
+	request := `
+	{
+		"denied_annotations": [ "cost-*" ],
+		"constrained_annotations": {
+			"cost-center": ".*"
+		}
+	}
+	`
+	rawRequest := []byte(request)
+	responsePayload, err := validateSettings(rawRequest)
+	if err != nil {
+		t.Errorf("Unexpected error %+v", err)
+	}
+
+	var response kubewarden_protocol.SettingsValidationResponse
+	if err := json.Unmarshal(responsePayload, &response); err != nil {
+		t.Errorf("Unexpected error: %+v", err)
+	}
+
+	if response.Valid {
+		t.Error("Expected settings to not be valid")
+	}
+
+	if *response.Message != "Provided settings are not valid: These annotations cannot be constrained and denied at the same time: cost-center (denied by 'cost-*')" {
+		t.Errorf("Unexpected validation error message: %s", *response.Message)
+	}
+}
+
+func TestParseSettingsWithInvalidConstrainedKeyPattern(t *testing.T) {
+	settingsJSON := []byte(`
+	{
+		"constrained_annotations": {
+			"re:team\\.example\\.com/owner-[0-9": ".*"
+		}
+	}`)
+
+	err := json.Unmarshal(settingsJSON, &Settings{})
+	if err == nil {
+		t.Errorf("Didn't get expected error")
+	}
+}
+
+func TestConstraintsMatchingAnnotation(t *testing.T) {
+	settingsJSON := []byte(`
+	{
+		"constrained_annotations": {
+			"team.example.com/owner-1": "^team-a$",
+			"team.example.com/owner-*": "^team-",
+			"re:team\\.example\\.com/owner-\\d+": ".+"
+		}
+	}`)
+
+	settings := Settings{}
+	if err := json.Unmarshal(settingsJSON, &settings); err != nil {
+		t.Fatalf("Unexpected error %+v", err)
+	}
+
+	cases := map[string]int{
+		"team.example.com/owner-1":   3,
+		"team.example.com/owner-12":  2,
+		"team.example.com/owner-x":   1,
+		"team.example.com/owner":     0,
+		"xteam.example.com/owner-12": 0,
+	}
+
+	for annotation, expected := range cases {
+		if found := len(settings.constraintsFor(annotation)); found != expected {
+			t.Errorf("Expected %d constraints for %s, got %d", expected, annotation, found)
+		}
+	}
+}
+
+func TestParseSettingsWithRuleGroups(t *testing.T) {
+	settingsJSON := []byte(`
+	{
+		"denied_annotations": [ "foo" ],
+		"rules": [
+			{
+				"match": {
+					"api_groups": [ "apps", "" ],
+					"kinds": [ "Deployment", "Namespace" ]
+				},
+				"mandatory_annotations": [ "cost-center" ],
+				"constrained_annotations": {
+					"cost-center": "cc-\\d+"
+				}
+			}
+		]
+	}`)
+
+	settings := Settings{}
+	if err := json.Unmarshal(settingsJSON, &settings); err != nil {
+		t.Fatalf("Unexpected error %+v", err)
+	}
+
+	if !settings.DeniedAnnotations.Contains("foo") {
+		t.Error("Missing top-level denied annotation foo")
+	}
+
+	if len(settings.Rules) != 1 {
+		t.Fatalf("Expected one rule group, got %d", len(settings.Rules))
+	}
+
+	group := settings.Rules[0]
+	if !group.MandatoryAnnotations.Contains("cost-center") {
+		t.Error("Missing rule group mandatory annotation cost-center")
+	}
+
+	cases := map[requestScope]bool{
+		{Group: "apps", Version: "v1", Kind: "Deployment", Resource: "deployments"}: true,
+		{Group: "", Version: "v1", Kind: "Namespace", Resource: "namespaces"}:       true,
+		{Group: "", Version: "v1", Kind: "Event", Resource: "events"}:               false,
+		{Group: "extensions", Version: "v1", Kind: "Deployment"}:                    false,
+	}
+
+	for scope, expected := range cases {
+		if group.Match.matches(scope) != expected {
+			t.Errorf("Expected %+v to be matched: %v", scope, expected)
+		}
+	}
+}
+
+func TestDetectNotValidSettingsDueToRuleGroupConflictingWithTopLevelRules(t *testing.T) {
+	request := `
+	{
+		"denied_annotations": [ "owner" ],
+		"rules": [
+			{
+				"match": { "kinds": [ "Deployment" ] },
+				"mandatory_annotations": [ "cost-center" ]
+			},
+			{
+				"match": { "kinds": [ "Namespace" ] },
+				"mandatory_annotations": [ "owner" ]
+			}
+		]
+	}
+	`
+	rawRequest := []byte(request)
+	responsePayload, err := validateSettings(rawRequest)
+	if err != nil {
+		t.Errorf("Unexpected error %+v", err)
+	}
+
+	var response kubewarden_protocol.SettingsValidationResponse
+	if err := json.Unmarshal(responsePayload, &response); err != nil {
+		t.Errorf("Unexpected error: %+v", err)
+	}
+
+	if response.Valid {
+		t.Error("Expected settings to not be valid")
+	}
+
+	if *response.Message != "Provided settings are not valid: rules[1]: These annotations cannot be mandatory and denied at the same time: owner" {
+		t.Errorf("Unexpected validation error message: %s", *response.Message)
+	}
+}
+
+func TestDetectNotValidSettingsDueToOverlappingRuleGroups(t *testing.T) {
+	request := `
+	{
+		"rules": [
+			{
+				"match": { "kinds": [ "Deployment", "Job" ] },
+				"mandatory_annotations": [ "owner" ]
+			},
+			{
+				"match": { "kinds": [ "Deploy*" ] },
+				"denied_annotations": [ "owner" ]
+			},
+			{
+				"match": { "kinds": [ "Namespace" ] },
+				"denied_annotations": [ "owner" ]
+			}
+		]
+	}
+	`
+	responsePayload, err := validateSettings([]byte(request))
+	if err != nil {
+		t.Errorf("Unexpected error %+v", err)
+	}
+
+	var response kubewarden_protocol.SettingsValidationResponse
+	if err := json.Unmarshal(responsePayload, &response); err != nil {
+		t.Errorf("Unexpected error: %+v", err)
+	}
+
+	if response.Valid {
+		t.Error("Expected settings to not be valid")
+	}
+
+	// Namespaces are never matched by the first group
+	if *response.Message != "Provided settings are not valid: rules[0] and rules[1]: These annotations cannot be mandatory and denied at the same time: owner" {
+		t.Errorf("Unexpected validation error message: %s", *response.Message)
+	}
+}
+
+func TestRuleMatchOverlaps(t *testing.T) {
+	cases := []struct {
+		match, other string
+		expected     bool
+	}{
+		{`{}`, `{ "kinds": [ "Job" ] }`, true},
+		{`{ "kinds": [ "Job" ] }`, `{ "kinds": [ "Job", "CronJob" ] }`, true},
+		{`{ "kinds": [ "Job" ] }`, `{ "kinds": [ "Deployment" ] }`, false},
+		{`{ "kinds": [ "*Job" ] }`, `{ "kinds": [ "CronJob" ] }`, true},
+		{`{ "kinds": [ "*Job" ] }`, `{ "kinds": [ "Deployment" ] }`, false},
+		{`{ "kinds": [ "*Job" ] }`, `{ "kinds": [ "Deploy*" ] }`, true},
+		{`{ "kinds": [ "Job" ], "namespaces": [ "a" ] }`, `{ "kinds": [ "Job" ], "namespaces": [ "b" ] }`, false},
+	}
+
+	for _, tc := range cases {
+		var match, other RuleMatch
+		if err := json.Unmarshal([]byte(tc.match), &match); err != nil {
+			t.Fatalf("Unexpected error: %+v", err)
+		}
+		if err := json.Unmarshal([]byte(tc.other), &other); err != nil {
+			t.Fatalf("Unexpected error: %+v", err)
+		}
+		if overlaps := match.overlaps(&other); overlaps != tc.expected {
+			t.Errorf("%s %s: expected %v, got %v", tc.match, tc.other, tc.expected, overlaps)
+		}
+	}
+}
+
+func TestParseSettingsWithInvalidAction(t *testing.T) {
+	settingsJSON := []byte(`
+	{
+		"action": "drop",
+		"denied_annotations": [ "foo" ]
+	}`)
+
+	err := json.Unmarshal(settingsJSON, &Settings{})
+	if err == nil {
+		t.Errorf("Didn't get expected error")
+	}
+
+	err = json.Unmarshal([]byte(`{ "denied_annotations": [ { "key": "foo", "action": "drop" } ] }`), &Settings{})
+	if err == nil {
+		t.Errorf("Didn't get expected error for the action of the entry")
+	}
+}
+
+func TestRuleGroupsInheritTopLevelAction(t *testing.T) {
+	settingsJSON := []byte(`
+	{
+		"action": "strip",
+		"rules": [
+			{ "denied_annotations": [ "foo" ] },
+			{ "action": "reject", "denied_annotations": [ "bar" ] }
+		]
+	}`)
+
+	settings := Settings{}
+	if err := json.Unmarshal(settingsJSON, &settings); err != nil {
+		t.Fatalf("Unexpected error %+v", err)
+	}
+
+	if action := settings.Rules[0].deniedPattern("foo").action; action != ActionStrip {
+		t.Errorf("Expected foo to be stripped, got %s", action)
+	}
+	if action := settings.Rules[1].deniedPattern("bar").action; action != ActionReject {
+		t.Errorf("Expected bar to be rejected, got %s", action)
+	}
+}
+
+func TestParseSettingsWithMandatoryAnnotationDefaults(t *testing.T) {
+	settingsJSON := []byte(`
+	{
+		"mandatory_annotations": [
+			"owner",
+			{ "key": "cost-center", "default": "cc-0000" }
+		]
+	}`)
+
+	settings := Settings{}
+	if err := json.Unmarshal(settingsJSON, &settings); err != nil {
+		t.Fatalf("Unexpected error %+v", err)
+	}
+
+	for _, exp := range []string{"owner", "cost-center"} {
+		if !settings.MandatoryAnnotations.Contains(exp) {
+			t.Errorf("Missing mandatory annotation %s", exp)
+		}
+	}
+
+	if value := settings.mandatoryDefaults["cost-center"]; value != "cc-0000" {
+		t.Errorf("Unexpected default value for cost-center: %s", value)
+	}
+	if _, found := settings.mandatoryDefaults["owner"]; found {
+		t.Error("Didn't expect a default value for owner")
+	}
+}
+
+func TestDetectNotValidSettingsDueToDefaultViolatingConstraint(t *testing.T) {
+	request := `
+	{
+		"mandatory_annotations": [
+			{ "key": "cost-center", "default": "cc-none" }
+		],
+		"constrained_annotations": {
+			"cost-center": "^cc-\\d+$"
+		}
+	}
+	`
+	rawRequest := []byte(request)
+	responsePayload, err := validateSettings(rawRequest)
+	if err != nil {
+		t.Errorf("Unexpected error %+v", err)
+	}
+
+	var response kubewarden_protocol.SettingsValidationResponse
+	if err := json.Unmarshal(responsePayload, &response); err != nil {
+		t.Errorf("Unexpected error: %+v", err)
+	}
+
+	if response.Valid {
+		t.Error("Expected settings to not be valid")
+	}
+
+	if *response.Message != "Provided settings are not valid: The default values of these annotations are violating user constraints: cost-center" {
+		t.Errorf("Unexpected validation error message: %s", *response.Message)
+	}
+}
+
+func TestParseSettingsWithInvalidLocation(t *testing.T) {
+	settingsJSON := []byte(`
+	{
+		"locations": [ "object", "job_template" ]
+	}`)
+
+	err := json.Unmarshal(settingsJSON, &Settings{})
+	if err == nil {
+		t.Errorf("Didn't get expected error")
+	}
+}
+
+func TestParseSettingsWithInvalidTarget(t *testing.T) {
+	settingsJSON := []byte(`
+	{
+		"target": "finalizers"
+	}`)
+
+	err := json.Unmarshal(settingsJSON, &Settings{})
+	if err == nil {
+		t.Errorf("Didn't get expected error")
+	}
+}
+
+func TestParseSettingsWithCustomMessages(t *testing.T) {
+	settingsJSON := []byte(`
+	{
+		"denied_annotations": [
+			"foo",
+			{ "key": "bar", "message": "{{.Key}} is deprecated" }
+		],
+		"mandatory_annotations": [
+			{ "key": "owner", "message": "{{.Kind}} {{.Name}} needs an owner" }
+		],
+		"constrained_annotations": {
+			"cost-center": {
+				"regex": "cc-\\d+",
+				"message": "{{.Key}} must match {{.Expected}}",
+				"documentation_url": "https://wiki.example.com/cost-center"
+			}
+		}
+	}`)
+
+	settings := Settings{}
+	if err := json.Unmarshal(settingsJSON, &settings); err != nil {
+		t.Fatalf("Unexpected error %+v", err)
+	}
+
+	for _, exp := range []string{"foo", "bar"} {
+		if !settings.DeniedAnnotations.Contains(exp) {
+			t.Errorf("Missing denied annotation %s", exp)
+		}
+	}
+
+	re, found := settings.ConstrainedAnnotations["cost-center"]
+	if !found {
+		t.Fatal("Didn't find the expected constrained annotation")
+	}
+	if re.String() != `cc-\d+` {
+		t.Errorf("Unexpected regexp %s", re.String())
+	}
+
+	if message := settings.mandatoryMessages["owner"]; message == nil || message.Message == nil {
+		t.Error("Missing custom message of the mandatory annotation owner")
+	}
+}
+
+func TestDetectNotValidSettingsDueToBrokenMessageTemplates(t *testing.T) {
+	cases := map[string]string{
+		"unterminated action": `{
+			"denied_annotations": [ { "key": "foo", "message": "{{.Key" } ]
+		}`,
+		"unknown field": `{
+			"mandatory_annotations": [ { "key": "foo", "message": "{{.Owner}} is missing" } ]
+		}`,
+		"missing regex": `{
+			"constrained_annotations": { "foo": { "message": "{{.Key}}" } }
+		}`,
+	}
+
+	for name, request := range cases {
+		responsePayload, err := validateSettings([]byte(request))
+		if err != nil {
+			t.Errorf("%s: unexpected error %+v", name, err)
+		}
+
+		var response kubewarden_protocol.SettingsValidationResponse
+		if err := json.Unmarshal(responsePayload, &response); err != nil {
+			t.Errorf("%s: unexpected error: %+v", name, err)
+		}
+
+		if response.Valid {
+			t.Errorf("%s: expected settings to not be valid", name)
+		}
+	}
+}
+
+func TestRejectDefaultsViolatingTypedConstraints(t *testing.T) {
+	settingsJSON := []byte(`{
+		"mandatory_annotations": [ { "key": "replicas", "default": "0" } ],
+		"constrained_annotations": {
+			"replicas": { "type": "int", "min": 1 }
+		}
+	}`)
+
+	responsePayload, err := validateSettings(settingsJSON)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	var response kubewarden_protocol.SettingsValidationResponse
+	if err := json.Unmarshal(responsePayload, &response); err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	if response.Valid {
+		t.Fatal("Expected settings to be rejected")
+	}
+
+	expected := "Provided settings are not valid: The default values of these annotations are violating user constraints: replicas (must be at least 1)"
+	if *response.Message != expected {
+		t.Errorf("Unexpected message: %s", *response.Message)
+	}
+}
+
+func TestRejectTypedConstraintsWithMinGreaterThanMax(t *testing.T) {
+	for _, constraint := range []string{
+		`{ "type": "int", "min": 10, "max": 1 }`,
+		`{ "type": "duration", "min": "1h", "max": "30m" }`,
+		`{ "type": "quantity", "min": "1Gi", "max": "512Mi" }`,
+		`{ "type": "timestamp", "min": "2024-01-01T00:00:00Z", "max": "2023-01-01T00:00:00Z" }`,
+	} {
+		settingsJSON := []byte(`{ "constrained_annotations": { "limit": ` + constraint + ` } }`)
+
+		responsePayload, err := validateSettings(settingsJSON)
+		if err != nil {
+			t.Fatalf("Unexpected error: %+v", err)
+		}
+
+		var response kubewarden_protocol.SettingsValidationResponse
+		if err := json.Unmarshal(responsePayload, &response); err != nil {
+			t.Fatalf("Unexpected error: %+v", err)
+		}
+
+		if response.Valid {
+			t.Errorf("Expected %s to be rejected", constraint)
+		} else if !strings.Contains(*response.Message, "min cannot be greater than max") {
+			t.Errorf("Unexpected message: %s", *response.Message)
+		}
+	}
+
+	// Equal bounds accept a single value
+	settings := Settings{}
+	if err := json.Unmarshal([]byte(`{ "constrained_annotations": { "replicas": { "type": "int", "min": 3, "max": 3 } } }`), &settings); err != nil {
+		t.Errorf("Unexpected error: %+v", err)
+	}
+}
+
+func TestRuleGroupSizeLimitsTakePrecedence(t *testing.T) {
+	settingsJSON := []byte(`
+	{
+		"max_value_lengths": { "*": 1024 },
+		"max_annotations": 64,
+		"rules": [
+			{ "max_value_lengths": { "ci.example.com/*": 128 }, "max_annotations": 16 }
+		]
+	}`)
+
+	settings := Settings{}
+	if err := json.Unmarshal(settingsJSON, &settings); err != nil {
+		t.Fatalf("Unexpected error %+v", err)
+	}
+
+	merged := settings.RuleSet.merge(&settings.Rules[0].RuleSet)
+	if merged.MaxAnnotations != 16 {
+		t.Errorf("Expected max_annotations to be 16, got %d", merged.MaxAnnotations)
+	}
+	if exceeded := merged.exceededValueLengths("ci.example.com/log", 512); len(exceeded) != 1 || exceeded[0].limit != 128 {
+		t.Errorf("Unexpected exceeded limits: %+v", exceeded)
+	}
+}
+
+func TestRejectNonPositiveSizeLimits(t *testing.T) {
+	for _, settingsJSON := range []string{
+		`{ "max_value_lengths": { "owner": 0 } }`,
+		`{ "max_annotations": -1 }`,
+	} {
+		settings := Settings{}
+		if err := json.Unmarshal([]byte(settingsJSON), &settings); err == nil {
+			t.Errorf("Expected %s to be rejected", settingsJSON)
+		}
+	}
+}
+
+func TestRejectInvalidExemptions(t *testing.T) {
+	settings := Settings{}
+	if err := json.Unmarshal([]byte(`{ "exemptions": [ { "usernames": [ "bob" ], "categories": [ "unknown" ] } ] }`), &settings); err == nil {
+		t.Error("Expected unknown category to be rejected")
+	}
+
+	settingsJSON := []byte(`{ "exemptions": [ { "categories": [ "denied" ] } ] }`)
+	if err := json.Unmarshal(settingsJSON, &settings); err != nil {
+		t.Fatalf("Unexpected error %+v", err)
+	}
+
+	valid, err := settings.Valid()
+	if valid {
+		t.Fatal("Expected settings to be rejected")
+	}
+	expected := "exemptions[0]: at least one of usernames, groups or service_accounts is required"
+	if err.Error() != expected {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
+
+func TestRuleGroupsInheritTheTopLevelMode(t *testing.T) {
+	settingsJSON := []byte(`
+	{
+		"mode": "monitor",
+		"rules": [
+			{ "denied_annotations": [ "foo" ] },
+			{ "mode": "enforce", "denied_annotations": [ "bar" ] }
+		]
+	}`)
+
+	settings := Settings{}
+	if err := json.Unmarshal(settingsJSON, &settings); err != nil {
+		t.Fatalf("Unexpected error %+v", err)
+	}
+
+	if mode := settings.Rules[0].Mode; mode != ModeMonitor {
+		t.Errorf("Expected the first group to be monitored, got %s", mode)
+	}
+	if mode := settings.Rules[1].Mode; mode != ModeEnforce {
+		t.Errorf("Expected the second group to be enforced, got %s", mode)
+	}
+
+	if err := json.Unmarshal([]byte(`{ "mode": "warn" }`), &settings); err == nil {
+		t.Error("Expected unknown mode to be rejected")
+	}
+	for _, invalid := range []string{
+		`{ "denied_annotations": [ { "key": "foo", "mode": "warn" } ] }`,
+		`{ "mandatory_annotations": [ { "key": "foo", "mode": "warn" } ] }`,
+		`{ "constrained_annotations": { "foo": { "regex": "^a$", "mode": "warn" } } }`,
+		`{ "dependencies": [ { "key": "foo", "constrained_annotations": { "bar": { "regex": "^a$", "mode": "monitor" } } } ] }`,
+	} {
+		if err := json.Unmarshal([]byte(invalid), &Settings{}); err == nil {
+			t.Errorf("Expected the mode of the entry to be rejected: %s", invalid)
+		}
+	}
+}
+
+func TestRejectDependencyCycles(t *testing.T) {
+	settingsJSON := []byte(`{
+		"dependencies": [ { "key": "a", "requires": [ "b" ] } ],
+		"rules": [
+			{ "dependencies": [ { "key": "b", "requires": [ "a" ] } ] }
+		]
+	}`)
+
+	responsePayload, err := validateSettings(settingsJSON)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	var response kubewarden_protocol.SettingsValidationResponse
+	if err := json.Unmarshal(responsePayload, &response); err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	if response.Valid {
+		t.Fatal("Expected settings to be rejected")
+	}
+
+	expected := "Provided settings are not valid: rules[0]: These dependencies are requiring themselves: a -> b -> a"
+	if *response.Message != expected {
+		t.Errorf("Unexpected message: %s", *response.Message)
+	}
+}
+
+func TestRejectExclusiveAnnotationsThatCannotBeSatisfied(t *testing.T) {
+	settingsJSON := []byte(`{
+		"denied_annotations": [ "cert-manager.io/*" ],
+		"mandatory_annotations": [ "owner", "team" ],
+		"exclusive_annotations": [
+			{ "keys": [ "cert-manager.io/cluster-issuer", "cert-manager.io/issuer" ], "exactly_one": true },
+			{ "keys": [ "cert-manager.io/cluster-issuer", "cert-manager.io/issuer" ] },
+			{ "keys": [ "owner", "team", "cost-center" ] },
+			{ "keys": [ "owner", "cert-manager.io/*" ], "exactly_one": true }
+		]
+	}`)
+
+	responsePayload, err := validateSettings(settingsJSON)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	var response kubewarden_protocol.SettingsValidationResponse
+	if err := json.Unmarshal(responsePayload, &response); err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	if response.Valid {
+		t.Fatal("Expected settings to be rejected")
+	}
+
+	expected := "Provided settings are not valid: These exclusive annotations cannot be satisfied: " +
+		"cert-manager.io/cluster-issuer|cert-manager.io/issuer (all of them are denied)," +
+		"owner|team|cost-center (more of them are mandatory: owner team)"
+	if *response.Message != expected {
+		t.Errorf("Unexpected message: %s", *response.Message)
+	}
+
+	if err := json.Unmarshal([]byte(`{ "exclusive_annotations": [ { "keys": [ "owner" ] } ] }`), &Settings{}); err == nil {
+		t.Error("Expected a group with a single key to be rejected")
+	}
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"strings"
 
 	mapset "github.com/deckarep/golang-set/v2"
 	"github.com/kubewarden/gjson"
@@ -28,72 +27,313 @@ func validate(payload []byte) ([]byte, error) {
 			kubewarden.Code(400))
 	}
 
-	data := gjson.GetBytes(
-		payload,
-		"request.object.metadata.annotations")
+	// Pick only the rules that apply to the incoming resource
+	scope := newRequestScope(
+		validationRequest.Request,
+		gjson.GetBytes(payload, "request.resource.resource").String())
 
+	object := objectInfo{
+		Group:     scope.Group,
+		Kind:      scope.Kind,
+		Name:      gjson.GetBytes(payload, "request.object.metadata.name").String(),
+		Namespace: scope.Namespace,
+		raw:       gjson.GetBytes(payload, "request.object"),
+	}
+	if object.Name == "" {
+		object.Name = validationRequest.Request.Name
+	}
+
+	// Rules in monitor mode never reject, nor change, the object. Their
+	// violations are the ones found only when all the rules are applied.
+	enforced := settings.enforcedRuleSetFor(scope)
+	report, patches := validateObject(&settings, &enforced, object, payload, validationRequest.Request.Operation)
+
+	monitored := Report{}
+	if settings.monitors(scope) {
+		ruleSet := settings.ruleSetFor(scope)
+		all, allPatches := validateObject(&settings, &ruleSet, object, payload, validationRequest.Request.Operation)
+		monitored = all.without(&report)
+
+		// The changes of the rules in monitor mode are not made, the
+		// violations they would fix are reported instead
+		changes, applied := patchFixes(allPatches), patchFixes(patches)
+		monitored.add(changes.without(&applied).Violations...)
+	}
+
+	// Exempt users skip some categories of rules, what has been skipped
+	// is logged for auditing purposes
+	if categories, exemptions := settings.exemptCategories(validationRequest.Request.UserInfo); len(exemptions) > 0 {
+		var skipped, skippedMonitored exemptedFindings
+		patches, skipped = applyExemptions(&report, patches, categories)
+		_, skippedMonitored = applyExemptions(&monitored, nil, categories)
+		skipped.Violations = append(skipped.Violations, skippedMonitored.Violations...)
+		if !skipped.isEmpty() {
+			logEvent("info", "exemption applied", map[string]interface{}{
+				"uid":        validationRequest.Request.Uid,
+				"username":   validationRequest.Request.UserInfo.Username,
+				"exemptions": exemptions,
+				"skipped":    skipped,
+			})
+		}
+	}
+
+	if !report.isEmpty() {
+		logReport("request rejected", validationRequest.Request.Uid, &report)
+		// The rules in monitor mode are audited on rejected requests too
+		if !monitored.isEmpty() {
+			logReport("monitored violations of rejected request", validationRequest.Request.Uid, &monitored)
+		}
+		return kubewarden.RejectRequest(
+			kubewarden.Message(report.Message()),
+			kubewarden.NoCode)
+	}
+
+	// The violations of the rules in monitor mode are returned together
+	// with the accepted request, so that users see what would fail
+	message := ""
+	if !monitored.isEmpty() {
+		logReport("request accepted in monitor mode", validationRequest.Request.Uid, &monitored)
+		message = monitored.Message()
+	}
+
+	if len(patches) > 0 {
+		mutatedObject, err := applyPatches(validationRequest.Request.Object, patches)
+		if err != nil {
+			return kubewarden.RejectRequest(
+				kubewarden.Message(err.Error()),
+				kubewarden.Code(400))
+		}
+		return acceptRequest(message, mutatedObject)
+	}
+
+	return acceptRequest(message, nil)
+}
+
+// Accepts the request, like kubewarden.AcceptRequest and
+// kubewarden.MutateRequest do, with an optional message
+func acceptRequest(message string, mutatedObject interface{}) ([]byte, error) {
+	response := kubewarden_protocol.ValidationResponse{
+		Accepted:      true,
+		MutatedObject: mutatedObject,
+	}
+	if message != "" {
+		response.Message = &message
+	}
+
+	return json.Marshal(response)
+}
+
+// Logs the JSON form of the report
+func logReport(message, uid string, report *Report) {
+	reportJSON, err := report.JSON()
+	if err != nil {
+		return
+	}
+	logEvent("info", message, map[string]interface{}{
+		"uid":    uid,
+		"report": json.RawMessage(reportJSON),
+	})
+}
+
+// Validates all the metadata maps of the object selected by the settings
+// against the rules. Returns the violations, and the changes that have to
+// be made to the object.
+func validateObject(settings *Settings, ruleSet *RuleSet, object objectInfo, payload []byte, operation string) (Report, []metadataPatch) {
+	report := Report{}
+	patches := []metadataPatch{}
+
+	for _, metadataPath := range settings.metadataPaths(object.Group, object.Kind) {
+		for _, field := range settings.Target.fields() {
+			data := gjson.GetBytes(
+				payload,
+				"request.object."+metadataPath+"."+field)
+
+			var oldData *gjson.Result
+			if operation == "UPDATE" {
+				old := gjson.GetBytes(
+					payload,
+					"request.oldObject."+metadataPath+"."+field)
+				oldData = &old
+			}
+
+			violations, patch := validateMetadataMap(ruleSet, object, metadataPath, field, data, oldData)
+			report.add(violations...)
+
+			if !patch.isEmpty() {
+				patches = append(patches, patch)
+			}
+		}
+	}
+
+	return report, patches
+}
+
+// Validates a map of annotations, or labels, against the rules. The field
+// is the name of the map, either `annotations` or `labels`, found inside
+// of the metadata at metadataPath. The map of the old object is provided
+// only on UPDATE operations.
+// Returns the violations, and the changes that have to be made to the map.
+func validateMetadataMap(ruleSet *RuleSet, object objectInfo, metadataPath, field string, data gjson.Result, oldData *gjson.Result) ([]Violation, metadataPatch) {
 	annotations := mapset.NewThreadUnsafeSet[string]()
-	deniedAnnotationsViolations := []string{}
-	constrainedAnnotationsViolations := []string{}
+	violations := []Violation{}
+	patch := metadataPatch{
+		path:  metadataPath,
+		field: field,
+		add:   map[string]string{},
+	}
+
+	// The annotations kept on the object, and their size in bytes
+	count, size := 0, 0
+	values := map[string]string{}
+	// The secrets found inside of the values
+	secrets := map[string]*secretFinding{}
+
+	oldAnnotations := map[string]gjson.Result{}
+	if oldData != nil {
+		oldAnnotations = oldData.Map()
+	}
 
 	data.ForEach(func(key, value gjson.Result) bool {
 		annotation := key.String()
 		annotations.Add(annotation)
 
-		if settings.DeniedAnnotations.Contains(annotation) {
-			deniedAnnotationsViolations = append(deniedAnnotationsViolations, annotation)
+		// Stripped annotations are removed from the object, without
+		// rejecting it
+		pattern := ruleSet.deniedPattern(annotation)
+		if pattern != nil && pattern.action == ActionStrip {
+			patch.remove = append(patch.remove, annotation)
+			violation := newViolation(CategoryDenied, metadataPath, field, annotation, pattern.KeyPattern)
+			violation.Reason = "would be stripped"
+			violation.Message = pattern.message.render(violation.messageData(object, value.String(), ""))
+			patch.fixes = append(patch.fixes, violation)
 			return true
 		}
 
-		regExp, found := settings.ConstrainedAnnotations[annotation]
-		if found {
-			// This is a constrained annotation
-			if !regExp.Match([]byte(value.String())) {
-				constrainedAnnotationsViolations = append(constrainedAnnotationsViolations, annotation)
-				return true
+		count++
+		size += len(annotation) + len(value.String())
+		values[annotation] = value.String()
+
+		if ruleSet.SecretDetection != nil {
+			if finding := ruleSet.SecretDetection.detect(annotation, value.String()); finding != nil {
+				secrets[annotation] = finding
+				violation := newViolation(CategorySecret, metadataPath, field, annotation, literalKeyPattern(finding.detector))
+				violation.Reason = finding.description
+				violations = append(violations, violation)
+			}
+		}
+
+		if pattern != nil {
+			violation := newViolation(CategoryDenied, metadataPath, field, annotation, pattern.KeyPattern)
+			violation.Message = pattern.message.render(violation.messageData(object, value.String(), ""))
+			violations = append(violations, violation)
+			return true
+		}
+
+		if ruleSet.KeySyntax != nil {
+			if rule, reason := ruleSet.KeySyntax.check(annotation); rule != "" {
+				violation := newViolation(CategorySyntax, metadataPath, field, annotation, literalKeyPattern(rule))
+				violation.Reason = reason
+				violations = append(violations, violation)
+			}
+		}
+
+		// Annotations kept unchanged from the old object have not been
+		// written by the user
+		if ruleSet.ReservedPrefixes != nil {
+			old, found := oldAnnotations[annotation]
+			if !found || old.String() != value.String() {
+				if prefix := ruleSet.ReservedPrefixes.violatedPrefix(annotation); prefix != "" {
+					violations = append(violations,
+						newViolation(CategoryReserved, metadataPath, field, annotation, literalKeyPattern(prefix)))
+				}
+			}
+		}
+
+		for _, limit := range ruleSet.exceededValueLengths(annotation, len(value.String())) {
+			violation := newViolation(CategoryLength, metadataPath, field, annotation, limit.key)
+			violation.Size = len(value.String())
+			violation.Limit = limit.limit
+			violations = append(violations, violation)
+		}
+
+		for _, constraint := range ruleSet.failedConstraints(annotation, value.String(), object.raw) {
+			category := CategoryConstrained
+			if constraint.malformed {
+				category = CategoryMalformed
 			}
+			violation := newViolation(category, metadataPath, field, annotation, constraint.key)
+			violation.Reason = constraint.reason
+			violation.Message = constraint.message.render(
+				violation.messageData(object, value.String(), constraint.expected()))
+			violations = append(violations, violation)
 		}
 
 		return true
 	})
 
-	errorMsgs := []string{}
+	violations = append(violations, ruleSet.mapLimitViolations(metadataPath, field, count, size)...)
+	violations = append(violations, ruleSet.dependencyViolations(object, metadataPath, field, values)...)
+	violations = append(violations, ruleSet.exclusiveViolations(object, metadataPath, field, values)...)
 
-	if len(deniedAnnotationsViolations) > 0 {
-		errorMsgs = append(
-			errorMsgs,
-			fmt.Sprintf(
-				"The following annotations are not allowed: %s",
-				strings.Join(deniedAnnotationsViolations, ","),
-			))
+	// Missing annotations with a default value are added to the object
+	for _, annotation := range mapset.Sorted(ruleSet.MandatoryAnnotations.Difference(annotations)) {
+		violation := newViolation(CategoryMandatory, metadataPath, field, annotation, literalKeyPattern(annotation))
+		value, found := ruleSet.mandatoryDefaults[annotation]
+		if found {
+			violation.Reason = fmt.Sprintf("would be added with the value '%s'", value)
+		}
+		violation.Message = ruleSet.mandatoryMessages[annotation].render(violation.messageData(object, "", ""))
+		if found {
+			patch.add[annotation] = value
+			patch.fixes = append(patch.fixes, violation)
+		} else {
+			violations = append(violations, violation)
+		}
 	}
 
-	if len(constrainedAnnotationsViolations) > 0 {
-		errorMsgs = append(
-			errorMsgs,
-			fmt.Sprintf(
-				"The following annotations are violating user constraints: %s",
-				strings.Join(constrainedAnnotationsViolations, ","),
-			))
+	if oldData != nil {
+		violations = append(
+			violations,
+			findImmutableViolations(ruleSet, metadataPath, field, *oldData, data)...)
 	}
 
-	mandatoryAnnotationsViolations := settings.MandatoryAnnotations.Difference(annotations)
-	if mandatoryAnnotationsViolations.Cardinality() > 0 {
-		violations := mandatoryAnnotationsViolations.ToSlice()
-
-		errorMsgs = append(
-			errorMsgs,
-			fmt.Sprintf(
-				"The following mandatory annotations are missing: %s",
-				strings.Join(violations, ","),
-			))
+	// Secrets are never echoed, whatever the rule reporting their value
+	if ruleSet.SecretDetection != nil {
+		ruleSet.SecretDetection.redactViolations(violations, secrets)
 	}
 
-	if len(errorMsgs) > 0 {
-		return kubewarden.RejectRequest(
-			kubewarden.Message(strings.Join(errorMsgs, ". ")),
-			kubewarden.NoCode)
-	}
+	return violations, patch
+}
+
+// Returns the violations of the immutable annotations that have been set
+// on the old object, and that have been either changed or removed by the
+// new one
+func findImmutableViolations(ruleSet *RuleSet, metadataPath, field string, oldData, data gjson.Result) []Violation {
+	violations := []Violation{}
+	annotations := data.Map()
+
+	oldData.ForEach(func(key, oldValue gjson.Result) bool {
+		annotation := key.String()
+		pattern := ruleSet.immutablePattern(annotation)
+		if pattern == nil {
+			return true
+		}
+
+		violation := newViolation(CategoryImmutable, metadataPath, field, annotation, pattern)
+		old := oldValue.String()
+		violation.OldValue = &old
+
+		value, found := annotations[annotation]
+		if !found {
+			violations = append(violations, violation)
+		} else if value.String() != old {
+			current := value.String()
+			violation.Value = &current
+			violations = append(violations, violation)
+		}
+
+		return true
+	})
 
-	return kubewarden.AcceptRequest()
+	return violations
 }
@@ -1,22 +1,25 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
 	"regexp"
 	"testing"
 
-	"encoding/json"
-
 	mapset "github.com/deckarep/golang-set/v2"
+	"github.com/kubewarden/gjson"
 	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
 	kubewarden_testing "github.com/kubewarden/policy-sdk-go/testing"
 )
 
 func TestEmptySettingsLeadsToRequestAccepted(t *testing.T) {
-	settings := Settings{
+	settings := Settings{RuleSet: RuleSet{
 		DeniedAnnotations:      mapset.NewThreadUnsafeSet[string](),
 		MandatoryAnnotations:   mapset.NewThreadUnsafeSet[string](),
 		ConstrainedAnnotations: map[string]*RegularExpression{},
-	}
+	}}
 
 	payload, err := kubewarden_testing.BuildValidationRequestFromFixture(
 		"test_data/ingress.json",
@@ -41,7 +44,7 @@ func TestEmptySettingsLeadsToRequestAccepted(t *testing.T) {
 }
 
 func TestRequestAccepted(t *testing.T) {
-	settings := Settings{
+	settings := Settings{RuleSet: RuleSet{
 		DeniedAnnotations:    mapset.NewThreadUnsafeSet("bad1", "bad2"),
 		MandatoryAnnotations: mapset.NewThreadUnsafeSet[string](),
 		ConstrainedAnnotations: map[string]*RegularExpression{
@@ -49,7 +52,7 @@ func TestRequestAccepted(t *testing.T) {
 				Regexp: regexp.MustCompile(`^world-`),
 			},
 		},
-	}
+	}}
 
 	payload, err := kubewarden_testing.BuildValidationRequestFromFixture(
 		"test_data/ingress.json",
@@ -74,7 +77,7 @@ func TestRequestAccepted(t *testing.T) {
 }
 
 func TestAcceptRequestWithConstrainedAnnotation(t *testing.T) {
-	settings := Settings{
+	settings := Settings{RuleSet: RuleSet{
 		DeniedAnnotations:    mapset.NewThreadUnsafeSet("bad1", "bad2"),
 		MandatoryAnnotations: mapset.NewThreadUnsafeSet[string](),
 		ConstrainedAnnotations: map[string]*RegularExpression{
@@ -82,7 +85,7 @@ func TestAcceptRequestWithConstrainedAnnotation(t *testing.T) {
 				Regexp: regexp.MustCompile(`^team-`),
 			},
 		},
-	}
+	}}
 
 	payload, err := kubewarden_testing.BuildValidationRequestFromFixture(
 		"test_data/ingress.json",
@@ -107,7 +110,7 @@ func TestAcceptRequestWithConstrainedAnnotation(t *testing.T) {
 }
 
 func TestRejectionBecauseDeniedAnnotation(t *testing.T) {
-	settings := Settings{
+	settings := Settings{RuleSet: RuleSet{
 		DeniedAnnotations:    mapset.NewThreadUnsafeSet("owner"),
 		MandatoryAnnotations: mapset.NewThreadUnsafeSet[string](),
 		ConstrainedAnnotations: map[string]*RegularExpression{
@@ -115,7 +118,7 @@ func TestRejectionBecauseDeniedAnnotation(t *testing.T) {
 				Regexp: regexp.MustCompile(`^world-`),
 			},
 		},
-	}
+	}}
 
 	payload, err := kubewarden_testing.BuildValidationRequestFromFixture(
 		"test_data/ingress.json",
@@ -145,7 +148,7 @@ func TestRejectionBecauseDeniedAnnotation(t *testing.T) {
 }
 
 func TestRejectionBecauseConstrainedAnnotationNotValid(t *testing.T) {
-	settings := Settings{
+	settings := Settings{RuleSet: RuleSet{
 		DeniedAnnotations:    mapset.NewThreadUnsafeSet[string](),
 		MandatoryAnnotations: mapset.NewThreadUnsafeSet[string](),
 		ConstrainedAnnotations: map[string]*RegularExpression{
@@ -153,7 +156,7 @@ func TestRejectionBecauseConstrainedAnnotationNotValid(t *testing.T) {
 				Regexp: regexp.MustCompile(`^cc-\d+$`),
 			},
 		},
-	}
+	}}
 
 	payload, err := kubewarden_testing.BuildValidationRequestFromFixture(
 		"test_data/ingress.json",
@@ -183,11 +186,11 @@ func TestRejectionBecauseConstrainedAnnotationNotValid(t *testing.T) {
 }
 
 func TestRejectionBecauseMandatoryAnnotationMissing(t *testing.T) {
-	settings := Settings{
+	settings := Settings{RuleSet: RuleSet{
 		DeniedAnnotations:      mapset.NewThreadUnsafeSet[string](),
 		MandatoryAnnotations:   mapset.NewThreadUnsafeSet("required"),
 		ConstrainedAnnotations: map[string]*RegularExpression{},
-	}
+	}}
 
 	payload, err := kubewarden_testing.BuildValidationRequestFromFixture(
 		"test_data/ingress.json",
@@ -215,3 +218,940 @@ func TestRejectionBecauseMandatoryAnnotationMissing(t *testing.T) {
 		t.Errorf("Got '%s' instead of '%s'", *response.Message, expectedMessage)
 	}
 }
+
+func validateFixture(t *testing.T, fixture string, settings string) kubewarden_protocol.ValidationResponse {
+	t.Helper()
+
+	request, err := os.ReadFile(fixture)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	// The request is not decoded into a KubernetesAdmissionRequest, that
+	// would drop the fields the SDK does not know about, like
+	// request.resource.resource
+	payload, err := json.Marshal(map[string]json.RawMessage{
+		"request":  request,
+		"settings": json.RawMessage(settings),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	responsePayload, err := validate(payload)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	var response kubewarden_protocol.ValidationResponse
+	if err := json.Unmarshal(responsePayload, &response); err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	return response
+}
+
+func TestAcceptWhenNoSettingsAreProvided(t *testing.T) {
+	response := validateFixture(t, "test_data/ingress.json", `{}`)
+
+	if !response.Accepted {
+		t.Errorf("Expected request to be accepted: %s", *response.Message)
+	}
+}
+
+func TestRejectAnnotationDeniedByPattern(t *testing.T) {
+	response := validateFixture(t, "test_data/ingress.json", `{
+		"denied_annotations": [ "own*" ]
+	}`)
+
+	if response.Accepted {
+		t.Fatal("Expected request to be rejected")
+	}
+
+	expected := "The following annotations are not allowed: owner (denied by 'own*')"
+	if *response.Message != expected {
+		t.Errorf("Unexpected message: %s", *response.Message)
+	}
+}
+
+func TestAcceptAnnotationMatchingEscapedPattern(t *testing.T) {
+	response := validateFixture(t, "test_data/ingress.json", `{
+		"denied_annotations": [ "own\\*" ]
+	}`)
+
+	if !response.Accepted {
+		t.Errorf("Expected request to be accepted: %s", *response.Message)
+	}
+}
+
+func TestRejectAnnotationViolatingConstraintMatchedByPattern(t *testing.T) {
+	response := validateFixture(t, "test_data/ingress.json", `{
+		"constrained_annotations": {
+			"re:cc-.*": "^cc-\\d+$",
+			"owner": "^team-"
+		}
+	}`)
+
+	if response.Accepted {
+		t.Fatal("Expected request to be rejected")
+	}
+
+	expected := "The following annotations are violating user constraints: cc-center (matched 're:cc-.*')"
+	if *response.Message != expected {
+		t.Errorf("Unexpected message: %s", *response.Message)
+	}
+}
+
+func TestRejectAnnotationViolatingEveryMatchingConstraint(t *testing.T) {
+	response := validateFixture(t, "test_data/ingress.json", `{
+		"constrained_annotations": {
+			"owner": "^team-",
+			"own*": "-infra$",
+			"re:o.*": "^team-ops$"
+		}
+	}`)
+
+	if response.Accepted {
+		t.Fatal("Expected request to be rejected")
+	}
+
+	expected := "The following annotations are violating user constraints: owner (matched 're:o.*')"
+	if *response.Message != expected {
+		t.Errorf("Unexpected message: %s", *response.Message)
+	}
+}
+
+func TestRuleGroupsAreSelectedByKindAndResource(t *testing.T) {
+	response := validateFixture(t, "test_data/ingress.json", `{
+		"rules": [
+			{
+				"match": { "api_groups": [ "apps" ], "kinds": [ "Deployment" ] },
+				"mandatory_annotations": [ "cost-center" ]
+			},
+			{
+				"match": { "api_groups": [ "networking.k8s.io" ], "resources": [ "ingresses" ] },
+				"mandatory_annotations": [ "team" ]
+			},
+			{
+				"match": { "kinds": [ "Ingress" ], "api_versions": [ "v1beta1" ] },
+				"denied_annotations": [ "owner" ]
+			}
+		]
+	}`)
+
+	if response.Accepted {
+		t.Fatal("Expected request to be rejected")
+	}
+
+	expected := "The following mandatory annotations are missing: team"
+	if *response.Message != expected {
+		t.Errorf("Unexpected message: %s", *response.Message)
+	}
+}
+
+func TestRuleGroupsAreSelectedByNamespace(t *testing.T) {
+	settings := `{
+		"rules": [
+			{
+				"match": { "namespaces": [ "team-*" ], "excluded_namespaces": [ "team-sandbox" ] },
+				"mandatory_annotations": [ "cost-center" ]
+			}
+		]
+	}`
+
+	cases := map[string]bool{
+		"test_data/ingress.json":              true,
+		"test_data/ingress-team-a.json":       false,
+		"test_data/ingress-team-sandbox.json": true,
+	}
+
+	for fixture, accepted := range cases {
+		response := validateFixture(t, fixture, settings)
+		if response.Accepted != accepted {
+			t.Errorf("%s: expected request to be accepted: %v", fixture, accepted)
+		}
+	}
+}
+
+func TestRejectChangesToImmutableAnnotations(t *testing.T) {
+	response := validateFixture(t, "test_data/ingress-update.json", `{
+		"immutable_annotations": [ "cc-center", "owner", "te*" ]
+	}`)
+
+	if response.Accepted {
+		t.Fatal("Expected request to be rejected")
+	}
+
+	expected := "The following immutable annotations cannot be changed: cc-center (from 'cc-1234' to 'cc-1234a'),team (from 'infra' to <removed>)"
+	if *response.Message != expected {
+		t.Errorf("Unexpected message: %s", *response.Message)
+	}
+}
+
+func TestAcceptImmutableAnnotationsOnCreate(t *testing.T) {
+	response := validateFixture(t, "test_data/ingress.json", `{
+		"immutable_annotations": [ "cc-center", "owner" ]
+	}`)
+
+	if !response.Accepted {
+		t.Errorf("Expected request to be accepted: %s", *response.Message)
+	}
+}
+
+func decodeJSONWithNumbers(t *testing.T, data []byte) interface{} {
+	t.Helper()
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	return value
+}
+
+func TestMutateRequestStrippingDeniedAnnotations(t *testing.T) {
+	response := validateFixture(t, "test_data/ingress.json", `{
+		"action": "strip",
+		"denied_annotations": [ "own*" ]
+	}`)
+
+	if !response.Accepted {
+		t.Fatalf("Expected request to be accepted: %s", *response.Message)
+	}
+	if response.MutatedObject == nil {
+		t.Fatal("Expected the object to be mutated")
+	}
+
+	mutatedObject, err := json.Marshal(response.MutatedObject)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	// The rest of the object must round-trip unchanged
+	fixture, err := os.ReadFile("test_data/ingress.json")
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	expectedObject := decodeJSONWithNumbers(t, []byte(gjson.GetBytes(fixture, "object").Raw))
+	annotations := expectedObject.(map[string]interface{})["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
+	delete(annotations, "owner")
+
+	if !reflect.DeepEqual(decodeJSONWithNumbers(t, mutatedObject), expectedObject) {
+		t.Errorf("Unexpected mutated object: %s", mutatedObject)
+	}
+}
+
+func TestRejectInsteadOfStrippingWhenOtherViolationsAreFound(t *testing.T) {
+	response := validateFixture(t, "test_data/ingress.json", `{
+		"denied_annotations": [ "cc-center" ],
+		"rules": [
+			{
+				"action": "strip",
+				"denied_annotations": [ "owner" ],
+				"mandatory_annotations": [ "team" ]
+			}
+		]
+	}`)
+
+	if response.Accepted {
+		t.Fatal("Expected request to be rejected")
+	}
+
+	expected := "The following annotations are not allowed: cc-center. The following mandatory annotations are missing: team"
+	if *response.Message != expected {
+		t.Errorf("Unexpected message: %s", *response.Message)
+	}
+}
+
+func TestRejectWinsOverStrip(t *testing.T) {
+	response := validateFixture(t, "test_data/ingress.json", `{
+		"denied_annotations": [ "owner" ],
+		"rules": [
+			{
+				"action": "strip",
+				"denied_annotations": [ "owner" ]
+			}
+		]
+	}`)
+
+	if response.Accepted {
+		t.Fatal("Expected request to be rejected")
+	}
+}
+
+func TestDeniedEntriesWithTheirOwnAction(t *testing.T) {
+	response := validateFixture(t, "test_data/ingress.json", `{
+		"denied_annotations": [ { "key": "owner", "action": "strip" } ]
+	}`)
+
+	if !response.Accepted {
+		t.Fatalf("Expected request to be accepted: %s", *response.Message)
+	}
+	mutatedObject, err := json.Marshal(response.MutatedObject)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if gjson.GetBytes(mutatedObject, "metadata.annotations.owner").Exists() {
+		t.Errorf("Expected owner to be stripped: %s", mutatedObject)
+	}
+
+	// The entries without an action use the one of the rules
+	response = validateFixture(t, "test_data/ingress.json", `{
+		"action": "strip",
+		"denied_annotations": [ "owner", { "key": "cc-center", "action": "reject" } ]
+	}`)
+
+	if response.Accepted {
+		t.Fatal("Expected request to be rejected")
+	}
+	if expected := "The following annotations are not allowed: cc-center"; *response.Message != expected {
+		t.Errorf("Unexpected message: %s", *response.Message)
+	}
+}
+
+func TestMutateRequestAddingMandatoryAnnotationDefaults(t *testing.T) {
+	response := validateFixture(t, "test_data/ingress.json", `{
+		"mandatory_annotations": [
+			"owner",
+			{ "key": "cost-center", "default": "cc-0000" }
+		]
+	}`)
+
+	if !response.Accepted {
+		t.Fatalf("Expected request to be accepted: %s", *response.Message)
+	}
+
+	mutatedObject, err := json.Marshal(response.MutatedObject)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	annotations := gjson.GetBytes(mutatedObject, "metadata.annotations").Map()
+	expected := map[string]string{
+		"cc-center":   "cc-1234a",
+		"owner":       "team-infra",
+		"cost-center": "cc-0000",
+	}
+	if len(annotations) != len(expected) {
+		t.Errorf("Unexpected annotations: %v", annotations)
+	}
+	for key, value := range expected {
+		if annotations[key].String() != value {
+			t.Errorf("Expected annotation %s to be %s, got %s", key, value, annotations[key].String())
+		}
+	}
+}
+
+func TestRejectMissingMandatoryAnnotationsWithoutDefault(t *testing.T) {
+	response := validateFixture(t, "test_data/ingress.json", `{
+		"mandatory_annotations": [
+			"team",
+			{ "key": "cost-center", "default": "cc-0000" }
+		]
+	}`)
+
+	if response.Accepted {
+		t.Fatal("Expected request to be rejected")
+	}
+
+	expected := "The following mandatory annotations are missing: team"
+	if *response.Message != expected {
+		t.Errorf("Unexpected message: %s", *response.Message)
+	}
+}
+
+func TestPodTemplateAnnotationsAreValidatedOnlyWhenRequested(t *testing.T) {
+	response := validateFixture(t, "test_data/deployment.json", `{
+		"denied_annotations": [ "prometheus.io/*" ]
+	}`)
+
+	if !response.Accepted {
+		t.Errorf("Expected request to be accepted: %s", *response.Message)
+	}
+
+	response = validateFixture(t, "test_data/deployment.json", `{
+		"locations": [ "object", "pod_template" ],
+		"denied_annotations": [ "prometheus.io/*" ],
+		"constrained_annotations": {
+			"cc-center": "^cc-\\d+$"
+		}
+	}`)
+
+	if response.Accepted {
+		t.Fatal("Expected request to be rejected")
+	}
+
+	expected := "spec.template.metadata.annotations: The following annotations are not allowed: prometheus.io/scrape (denied by 'prometheus.io/*'). " +
+		"spec.template.metadata.annotations: The following annotations are violating user constraints: cc-center"
+	if *response.Message != expected {
+		t.Errorf("Unexpected message: %s", *response.Message)
+	}
+}
+
+func TestPodTemplatesOfCustomResourcesAreNotValidated(t *testing.T) {
+	// A custom resource named Deployment is not a workload controller
+	response := validateFixture(t, "test_data/custom-deployment.json", `{
+		"locations": [ "object", "pod_template" ],
+		"denied_annotations": [ "prometheus.io/*" ]
+	}`)
+
+	if !response.Accepted {
+		t.Errorf("Expected request to be accepted: %s", *response.Message)
+	}
+}
+
+func TestMutateCronJobPodTemplateWithoutMetadata(t *testing.T) {
+	response := validateFixture(t, "test_data/cronjob.json", `{
+		"locations": [ "object", "pod_template" ],
+		"mandatory_annotations": [
+			{ "key": "owner", "default": "team-unknown" }
+		]
+	}`)
+
+	if !response.Accepted {
+		t.Fatalf("Expected request to be accepted: %s", *response.Message)
+	}
+
+	mutatedObject, err := json.Marshal(response.MutatedObject)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	if value := gjson.GetBytes(mutatedObject, "metadata.annotations.owner").String(); value != "team-infra" {
+		t.Errorf("Unexpected owner of the CronJob: %s", value)
+	}
+	if value := gjson.GetBytes(mutatedObject, "spec.jobTemplate.spec.template.metadata.annotations.owner").String(); value != "team-unknown" {
+		t.Errorf("Unexpected owner of the pod template: %s", value)
+	}
+}
+
+func TestValidateLabels(t *testing.T) {
+	response := validateFixture(t, "test_data/deployment.json", `{
+		"target": "labels",
+		"denied_annotations": [ "owner" ],
+		"mandatory_annotations": [ "app", "cost-center" ],
+		"constrained_annotations": {
+			"team": "^team-"
+		}
+	}`)
+
+	if response.Accepted {
+		t.Fatal("Expected request to be rejected")
+	}
+
+	expected := "The following labels are violating user constraints: team. The following mandatory labels are missing: cost-center"
+	if *response.Message != expected {
+		t.Errorf("Unexpected message: %s", *response.Message)
+	}
+}
+
+func TestValidateBothLabelsAndAnnotations(t *testing.T) {
+	response := validateFixture(t, "test_data/deployment.json", `{
+		"target": "both",
+		"locations": [ "pod_template" ],
+		"mandatory_annotations": [ "app" ]
+	}`)
+
+	if response.Accepted {
+		t.Fatal("Expected request to be rejected")
+	}
+
+	expected := "spec.template.metadata.annotations: The following mandatory annotations are missing: app"
+	if *response.Message != expected {
+		t.Errorf("Unexpected message: %s", *response.Message)
+	}
+}
+
+func TestRejectWithCustomMessages(t *testing.T) {
+	response := validateFixture(t, "test_data/ingress.json", `{
+		"denied_annotations": [
+			{ "key": "own*", "message": "{{.Key}} is denied by {{.Pattern}} on {{.Kind}} {{.Name}}" }
+		],
+		"mandatory_annotations": [
+			"team",
+			{
+				"key": "cost-center",
+				"message": "{{.Key}} is mandatory, see {{.DocumentationURL}}",
+				"documentation_url": "https://wiki.example.com/cost-center"
+			}
+		],
+		"constrained_annotations": {
+			"cc-center": {
+				"regex": "^cc-\\d+$",
+				"message": "{{.Key}}={{.Value}} does not match {{.Expected}}"
+			}
+		}
+	}`)
+
+	if response.Accepted {
+		t.Fatal("Expected request to be rejected")
+	}
+
+	expected := "owner is denied by own* on Ingress tls-example-ingress. " +
+		"cc-center=cc-1234a does not match ^cc-\\d+$. " +
+		"The following mandatory annotations are missing: team. " +
+		"cost-center is mandatory, see https://wiki.example.com/cost-center"
+	if *response.Message != expected {
+		t.Errorf("Unexpected message: %s", *response.Message)
+	}
+}
+
+func TestRejectAnnotationsViolatingTypedConstraints(t *testing.T) {
+	response := validateFixture(t, "test_data/ingress.json", `{
+		"constrained_annotations": {
+			"own*": { "type": "enum", "values": ["team-a", "team-b"] },
+			"cc-center": {
+				"regex": "^cc-",
+				"type": "int",
+				"message": "{{.Key}} is not {{.Expected}}: {{.Reason}}"
+			}
+		}
+	}`)
+
+	if response.Accepted {
+		t.Fatal("Expected request to be rejected")
+	}
+
+	expected := "The following annotations are violating user constraints: " +
+		"owner (matched 'own*': must be one of 'team-a' 'team-b'). " +
+		"cc-center is not ^cc-: must be an integer"
+	if *response.Message != expected {
+		t.Errorf("Unexpected message: %s", *response.Message)
+	}
+}
+
+func TestRejectMalformedJSONAnnotations(t *testing.T) {
+	response := validateFixture(t, "test_data/ingress.json", `{
+		"constrained_annotations": {
+			"owner": { "type": "json", "assertions": [ { "path": "team" } ] },
+			"cc-center": { "regex": "^cc-\\d+$" }
+		}
+	}`)
+
+	if response.Accepted {
+		t.Fatal("Expected request to be rejected")
+	}
+
+	expected := "The following annotations are violating user constraints: cc-center. " +
+		"The values of the following annotations cannot be parsed: " +
+		"owner (must be valid JSON: invalid character 'e' in literal true (expecting 'r'))"
+	if *response.Message != expected {
+		t.Errorf("Unexpected message: %s", *response.Message)
+	}
+}
+
+func TestRejectListElementsViolatingConstraints(t *testing.T) {
+	response := validateFixture(t, "test_data/ingress.json", `{
+		"constrained_annotations": {
+			"owner": { "separator": "-", "type": "enum", "values": ["team", "web"] },
+			"cc-center": { "separator": "-", "min_items": 3 }
+		}
+	}`)
+
+	if response.Accepted {
+		t.Fatal("Expected request to be rejected")
+	}
+
+	expected := "The following annotations are violating user constraints: " +
+		"cc-center (must have at least 3 elements)," +
+		"owner (element 'infra' must be one of 'team' 'web')"
+	if *response.Message != expected {
+		t.Errorf("Unexpected message: %s", *response.Message)
+	}
+}
+
+func TestAcceptAnnotationsSatisfyingTypedConstraints(t *testing.T) {
+	response := validateFixture(t, "test_data/ingress.json", `{
+		"constrained_annotations": {
+			"owner": { "type": "enum", "values": ["team-infra"] },
+			"cc-center": { "regex": "^cc-\\d+a$" }
+		}
+	}`)
+
+	if !response.Accepted {
+		t.Errorf("Expected request to be accepted: %s", *response.Message)
+	}
+}
+
+func TestRejectAnnotationsExceedingSizeLimits(t *testing.T) {
+	response := validateFixture(t, "test_data/ingress.json", `{
+		"max_value_lengths": { "owner": 5, "c*": 4, "*": 1024 },
+		"max_annotations": 1,
+		"max_annotations_bytes": 20
+	}`)
+
+	if response.Accepted {
+		t.Fatal("Expected request to be rejected")
+	}
+
+	expected := "The values of the following annotations are too long: " +
+		"cc-center (8 bytes, limit 4 of 'c*'),owner (10 bytes, limit 5). " +
+		"Too many annotations: 2, limit 1. " +
+		"The annotations are too large: 32 bytes, limit 20"
+	if *response.Message != expected {
+		t.Errorf("Unexpected message: %s", *response.Message)
+	}
+}
+
+func TestStrippedAnnotationsDoNotCountTowardsSizeLimits(t *testing.T) {
+	response := validateFixture(t, "test_data/ingress.json", `{
+		"denied_annotations": [ "owner" ],
+		"action": "strip",
+		"max_annotations": 1,
+		"max_annotations_bytes": 17
+	}`)
+
+	if !response.Accepted {
+		t.Errorf("Expected request to be accepted: %s", *response.Message)
+	}
+}
+
+func TestRejectAnnotationsWithInvalidKeys(t *testing.T) {
+	response := validateFixture(t, "test_data/deployment.json", `{
+		"locations": [ "pod_template" ],
+		"key_syntax": {
+			"allowed_prefixes": [ "*.example.com/" ],
+			"forbid_unprefixed": true
+		}
+	}`)
+
+	if response.Accepted {
+		t.Fatal("Expected request to be rejected")
+	}
+
+	expected := "spec.template.metadata.annotations: The following annotations have invalid keys: " +
+		"cc-center (a prefix is required),prometheus.io/scrape (prefix 'prometheus.io' is not allowed)"
+	if *response.Message != expected {
+		t.Errorf("Unexpected message: %s", *response.Message)
+	}
+}
+
+func TestRejectAnnotationsUsingReservedPrefixes(t *testing.T) {
+	response := validateFixture(t, "test_data/ingress-reserved.json", `{
+		"reserved_prefixes": { "kubewarden": true }
+	}`)
+
+	if response.Accepted {
+		t.Fatal("Expected request to be rejected")
+	}
+
+	// k8s.io/legacy has not been changed by the request
+	expected := "The following annotations are using reserved prefixes: " +
+		"example.kubernetes.io/owner,k8s.io/tier,kubewarden.io/policy"
+	if *response.Message != expected {
+		t.Errorf("Unexpected message: %s", *response.Message)
+	}
+}
+
+func TestAcceptReservedKeysAllowedBySettings(t *testing.T) {
+	response := validateFixture(t, "test_data/ingress-reserved.json", `{
+		"reserved_prefixes": {
+			"allowed_keys": [ "example.kubernetes.io/*", "k8s.io/tier" ]
+		}
+	}`)
+
+	if !response.Accepted {
+		t.Errorf("Expected request to be accepted: %s", *response.Message)
+	}
+}
+
+func TestExemptServiceAccountSkipsCategories(t *testing.T) {
+	settings := `{
+		"denied_annotations": [ "owner" ],
+		"mandatory_annotations": [ "team" ],
+		"exemptions": [
+			{ "service_accounts": [ "cert-manager/*" ], "categories": [ "denied" ] }
+		]
+	}`
+
+	response := validateFixture(t, "test_data/ingress-service-account.json", settings)
+	if response.Accepted {
+		t.Fatal("Expected request to be rejected")
+	}
+	if expected := "The following mandatory annotations are missing: team"; *response.Message != expected {
+		t.Errorf("Unexpected message: %s", *response.Message)
+	}
+
+	// Other users are not exempt
+	response = validateFixture(t, "test_data/ingress.json", settings)
+	if response.Accepted {
+		t.Fatal("Expected request to be rejected")
+	}
+	expected := "The following annotations are not allowed: owner. " +
+		"The following mandatory annotations are missing: team"
+	if *response.Message != expected {
+		t.Errorf("Unexpected message: %s", *response.Message)
+	}
+}
+
+func TestExemptGroupSkipsAllCategories(t *testing.T) {
+	response := validateFixture(t, "test_data/ingress-service-account.json", `{
+		"denied_annotations": [ "owner" ],
+		"mandatory_annotations": [ "team" ],
+		"exemptions": [ { "groups": [ "system:serviceaccounts:cert-manager" ] } ]
+	}`)
+
+	if !response.Accepted {
+		t.Errorf("Expected request to be accepted: %s", *response.Message)
+	}
+}
+
+func TestAcceptViolationsInMonitorMode(t *testing.T) {
+	response := validateFixture(t, "test_data/ingress.json", `{
+		"mode": "monitor",
+		"denied_annotations": [ "owner" ],
+		"mandatory_annotations": [ { "key": "team", "default": "infra" } ]
+	}`)
+
+	if !response.Accepted {
+		t.Fatalf("Expected request to be accepted: %s", *response.Message)
+	}
+	if response.MutatedObject != nil {
+		t.Error("Rules in monitor mode must not change the object")
+	}
+	// The default values that would be added are reported too
+	expected := "The following annotations are not allowed: owner. " +
+		"The following mandatory annotations are missing: team (would be added with the value 'infra')"
+	if response.Message == nil || *response.Message != expected {
+		t.Errorf("Unexpected message: %v", response.Message)
+	}
+
+	response = validateFixture(t, "test_data/ingress.json", `{
+		"mode": "monitor",
+		"action": "strip",
+		"denied_annotations": [ "owner" ]
+	}`)
+	if !response.Accepted {
+		t.Fatalf("Expected request to be accepted: %s", *response.Message)
+	}
+	if response.MutatedObject != nil {
+		t.Error("Rules in monitor mode must not change the object")
+	}
+	expected = "The following annotations are not allowed: owner (would be stripped)"
+	if response.Message == nil || *response.Message != expected {
+		t.Errorf("Unexpected message: %v", response.Message)
+	}
+}
+
+func TestRuleGroupsInMonitorMode(t *testing.T) {
+	settings := `{
+		"mandatory_annotations": [ "owner" ],
+		"rules": [
+			{
+				"match": { "kinds": [ "Ingress" ] },
+				"mode": "monitor",
+				"denied_annotations": [ "own*" ],
+				"mandatory_annotations": [ "team" ]
+			}
+		]
+	}`
+
+	response := validateFixture(t, "test_data/ingress.json", settings)
+	if !response.Accepted {
+		t.Fatalf("Expected request to be accepted: %s", *response.Message)
+	}
+	expected := "The following annotations are not allowed: owner (denied by 'own*'). " +
+		"The following mandatory annotations are missing: team"
+	if response.Message == nil || *response.Message != expected {
+		t.Errorf("Unexpected message: %v", response.Message)
+	}
+
+	// The top-level rules are still enforced
+	response = validateFixture(t, "test_data/ingress.json", `{
+		"mandatory_annotations": [ "cost-center" ],
+		"rules": [
+			{ "match": { "kinds": [ "Ingress" ] }, "mode": "monitor", "mandatory_annotations": [ "team" ] }
+		]
+	}`)
+	if response.Accepted {
+		t.Fatal("Expected request to be rejected")
+	}
+	if expected := "The following mandatory annotations are missing: cost-center"; *response.Message != expected {
+		t.Errorf("Unexpected message: %s", *response.Message)
+	}
+}
+
+func TestEntriesInMonitorMode(t *testing.T) {
+	// A single denied key is monitored, its siblings are still enforced
+	response := validateFixture(t, "test_data/ingress.json", `{
+		"denied_annotations": [ "cc-center", { "key": "owner", "mode": "monitor" } ]
+	}`)
+	if response.Accepted {
+		t.Fatal("Expected request to be rejected")
+	}
+	if expected := "The following annotations are not allowed: cc-center"; *response.Message != expected {
+		t.Errorf("Unexpected message: %s", *response.Message)
+	}
+
+	response = validateFixture(t, "test_data/ingress.json", `{
+		"denied_annotations": [ { "key": "owner", "mode": "monitor" } ],
+		"mandatory_annotations": [ { "key": "team", "default": "infra", "mode": "monitor" } ],
+		"constrained_annotations": { "cc-center": { "regex": "^cc-\\d+$", "mode": "monitor" } }
+	}`)
+	if !response.Accepted {
+		t.Fatalf("Expected request to be accepted: %s", *response.Message)
+	}
+	if response.MutatedObject != nil {
+		t.Error("Entries in monitor mode must not change the object")
+	}
+	expected := "The following annotations are not allowed: owner. " +
+		"The following annotations are violating user constraints: cc-center. " +
+		"The following mandatory annotations are missing: team (would be added with the value 'infra')"
+	if response.Message == nil || *response.Message != expected {
+		t.Errorf("Unexpected message: %v", response.Message)
+	}
+
+	// Entries can be enforced inside of rules in monitor mode
+	response = validateFixture(t, "test_data/ingress.json", `{
+		"mode": "monitor",
+		"denied_annotations": [ "cc-center", { "key": "owner", "mode": "enforce" } ]
+	}`)
+	if response.Accepted {
+		t.Fatal("Expected request to be rejected")
+	}
+	if expected := "The following annotations are not allowed: owner"; *response.Message != expected {
+		t.Errorf("Unexpected message: %s", *response.Message)
+	}
+}
+
+func TestRejectAnnotationsNotSatisfyingTheirDependencies(t *testing.T) {
+	response := validateFixture(t, "test_data/deployment.json", `{
+		"locations": [ "pod_template" ],
+		"dependencies": [
+			{
+				"key": "prometheus.io/scrape",
+				"value": "true",
+				"requires": [ "prometheus.io/port" ],
+				"constrained_annotations": {
+					"cc-center": { "type": "int" }
+				}
+			},
+			{ "key": "prometheus.io/scrape", "value": "false", "requires": [ "owner" ] },
+			{
+				"key": "re:cc-.*",
+				"regex": "^cc-",
+				"requires": [ "owner" ],
+				"message": "{{.Key}} is required by the cost center"
+			}
+		]
+	}`)
+
+	if response.Accepted {
+		t.Fatal("Expected request to be rejected")
+	}
+
+	expected := "spec.template.metadata.annotations: The following annotations do not satisfy their dependencies: " +
+		"cc-center (must be an integer, required by 'prometheus.io/scrape=true')," +
+		"prometheus.io/port (missing, required by 'prometheus.io/scrape=true'). " +
+		"spec.template.metadata.annotations: owner is required by the cost center"
+	if *response.Message != expected {
+		t.Errorf("Unexpected message: %s", *response.Message)
+	}
+}
+
+func TestRejectConflictingExclusiveAnnotations(t *testing.T) {
+	response := validateFixture(t, "test_data/ingress.json", `{
+		"exclusive_annotations": [
+			{ "keys": [ "owner", "cc-*" ] },
+			{ "keys": [ "cert-manager.io/cluster-issuer", "cert-manager.io/issuer" ], "exactly_one": true },
+			{ "keys": [ "team", "owner" ], "exactly_one": true }
+		]
+	}`)
+
+	if response.Accepted {
+		t.Fatal("Expected request to be rejected")
+	}
+
+	expected := "The following exclusive annotations are conflicting: " +
+		"cert-manager.io/cluster-issuer|cert-manager.io/issuer (exactly one must be set, found none)," +
+		"owner|cc-* (at most one can be set, found 'cc-center' 'owner')"
+	if *response.Message != expected {
+		t.Errorf("Unexpected message: %s", *response.Message)
+	}
+}
+
+func TestRejectAnnotationsNotMatchingReferencedFields(t *testing.T) {
+	response := validateFixture(t, "test_data/deployment.json", `{
+		"constrained_annotations": {
+			"owner": { "equals": "metadata.labels.team" }
+		}
+	}`)
+
+	if response.Accepted {
+		t.Fatal("Expected request to be rejected")
+	}
+	expected := "The following annotations are violating user constraints: " +
+		"owner (must be equal to metadata.labels.team)"
+	if *response.Message != expected {
+		t.Errorf("Unexpected message: %s", *response.Message)
+	}
+
+	response = validateFixture(t, "test_data/deployment.json", `{
+		"constrained_annotations": {
+			"owner": { "format": "team-${metadata.labels.team}" }
+		}
+	}`)
+	if !response.Accepted {
+		t.Errorf("Expected request to be accepted: %s", *response.Message)
+	}
+}
+
+func TestIngressNginxSnippetsProfile(t *testing.T) {
+	response := validateFixture(t, "test_data/ingress-snippets.json", `{
+		"profiles": ["ingress-nginx-snippets"]
+	}`)
+
+	if response.Accepted {
+		t.Fatal("Expected request to be rejected")
+	}
+	expected := "The following annotations are not allowed: " +
+		"nginx.ingress.kubernetes.io/configuration-snippet (denied by 'nginx.ingress.kubernetes.io/*-snippet')," +
+		"nginx.ingress.kubernetes.io/server-snippet (denied by 'nginx.ingress.kubernetes.io/*-snippet')"
+	if *response.Message != expected {
+		t.Errorf("Unexpected message: %s", *response.Message)
+	}
+
+	response = validateFixture(t, "test_data/ingress-snippets.json", `{
+		"profiles": ["ingress-nginx-restricted-snippets"]
+	}`)
+
+	if response.Accepted {
+		t.Fatal("Expected request to be rejected")
+	}
+	expected = "The following annotations are violating user constraints: " +
+		"nginx.ingress.kubernetes.io/configuration-snippet " +
+		"(matched 'nginx.ingress.kubernetes.io/*-snippet': uses the forbidden directive 'alias')"
+	if *response.Message != expected {
+		t.Errorf("Unexpected message: %s", *response.Message)
+	}
+}
+
+func TestRejectSecretsWithoutEchoingThem(t *testing.T) {
+	response := validateFixture(t, "test_data/ingress-secrets.json", `{
+		"secret_detection": {},
+		"constrained_annotations": {
+			"example.com/aws-credentials": {
+				"regex": "^arn:",
+				"message": "{{.Key}} is set to {{.Value}}"
+			}
+		}
+	}`)
+
+	if response.Accepted {
+		t.Fatal("Expected request to be rejected")
+	}
+	expected := "example.com/aws-credentials is set to <redacted>. " +
+		"The values of the following annotations look like secrets: example.com/aws-credentials (AWS access key)"
+	if *response.Message != expected {
+		t.Errorf("Unexpected message: %s", *response.Message)
+	}
+
+	response = validateFixture(t, "test_data/ingress-secrets.json", `{
+		"secret_detection": { "ignored_keys": [ "example.com/*" ] }
+	}`)
+	if !response.Accepted {
+		t.Errorf("Expected request to be accepted: %s", *response.Message)
+	}
+}